@@ -0,0 +1,79 @@
+package fulltext
+
+import (
+	"slices"
+
+	"github.com/dgryski/go-trigram"
+)
+
+// Index is the trigram index a Service uses to find candidate documents, mapping each
+// trigram to the ascending internal IDs of the documents containing it (its posting
+// list).  The default implementation is backed by github.com/dgryski/go-trigram, whose
+// semantics every implementation must follow:
+//
+//   - internal IDs are assigned sequentially from zero by AddTrigrams and are never
+//     reused, and trigram.TAllDocIDs lists every ID ever assigned, even after Delete
+//   - a pruned trigram keeps an empty posting list forever, which Posting reports as a
+//     nil list that is present, and documents added later are not listed under it
+//   - QueryTrigrams may reorder ts, ignores pruned trigrams and returns every ID listed
+//     under trigram.TAllDocIDs when all of ts have been pruned
+//
+// The Service serializes writes, but calls the read-only methods, QueryTrigrams,
+// Posting and Range, from concurrent searches, so those must be safe for concurrent use.
+type Index interface {
+	// AddTrigrams registers a new document containing the trigrams and returns its ID.
+	// It must not retain ts, which the Service reuses for the next document.
+	AddTrigrams(ts []trigram.T) trigram.DocID
+	// Delete removes id from the posting lists of every trigram of s
+	Delete(s string, id trigram.DocID)
+	// QueryTrigrams returns the IDs of the documents containing every trigram in ts
+	QueryTrigrams(ts []trigram.T) []trigram.DocID
+	// Prune discards the posting lists of trigrams found in more than the given fraction
+	// of documents, returning the number of trigrams pruned
+	Prune(pct float64) int
+	// Sort ensures every posting list is in ascending order
+	Sort()
+	// Posting returns the posting list of t.  ok is false when no document contains t,
+	// and the list is nil when t has been pruned.  The caller must not modify the list.
+	Posting(t trigram.T) (docIDs []trigram.DocID, ok bool)
+	// Range calls fn with every trigram and its posting list, including
+	// trigram.TAllDocIDs, in no particular order
+	Range(fn func(t trigram.T, docIDs []trigram.DocID))
+	// Clone returns a deep copy of the index, which Checkpoint keeps while the original
+	// goes on being modified
+	Clone() Index
+}
+
+// NewTrigramIndex returns an empty Index backed by github.com/dgryski/go-trigram,
+// the default used by NewService
+func NewTrigramIndex() Index {
+	return trigramIndex{trigram.NewIndex(nil)}
+}
+
+// trigramIndex adapts trigram.Index to the Index interface
+type trigramIndex struct {
+	trigram.Index
+}
+
+func (idx trigramIndex) Posting(t trigram.T) ([]trigram.DocID, bool) {
+	docIDs, ok := idx.Index[t]
+	return docIDs, ok
+}
+
+func (idx trigramIndex) Range(fn func(t trigram.T, docIDs []trigram.DocID)) {
+	for t, docIDs := range idx.Index {
+		fn(t, docIDs)
+	}
+}
+
+func (idx trigramIndex) Clone() Index {
+	clone := make(trigram.Index, len(idx.Index))
+	for t, posting := range idx.Index {
+		if posting == nil {
+			clone[t] = nil // pruned
+			continue
+		}
+		clone[t] = slices.Clone(posting)
+	}
+	return trigramIndex{clone}
+}
@@ -0,0 +1,125 @@
+package fulltext
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/dgryski/go-trigram"
+)
+
+// mapIndex is a minimal Index that never prunes and intersects posting lists naively
+type mapIndex struct {
+	postings map[trigram.T][]trigram.DocID
+	queries  *int // counts calls to QueryTrigrams
+}
+
+func newMapIndex(queries *int) Index {
+	return mapIndex{postings: make(map[trigram.T][]trigram.DocID), queries: queries}
+}
+
+func (idx mapIndex) AddTrigrams(ts []trigram.T) trigram.DocID {
+	id := trigram.DocID(len(idx.postings[trigram.TAllDocIDs]))
+	for _, t := range ts {
+		if posting := idx.postings[t]; len(posting) == 0 || posting[len(posting)-1] != id {
+			idx.postings[t] = append(posting, id)
+		}
+	}
+	idx.postings[trigram.TAllDocIDs] = append(idx.postings[trigram.TAllDocIDs], id)
+	return id
+}
+
+func (idx mapIndex) Delete(s string, id trigram.DocID) {
+	for _, t := range trigram.ExtractAll(s, nil) {
+		if i := slices.Index(idx.postings[t], id); i >= 0 {
+			idx.postings[t] = slices.Delete(idx.postings[t], i, i+1)
+		}
+	}
+}
+
+func (idx mapIndex) QueryTrigrams(ts []trigram.T) []trigram.DocID {
+	*idx.queries++
+	var docIDs []trigram.DocID
+	for _, id := range idx.postings[trigram.TAllDocIDs] {
+		all := true
+		for _, t := range ts {
+			all = all && slices.Contains(idx.postings[t], id)
+		}
+		if all {
+			docIDs = append(docIDs, id)
+		}
+	}
+	return docIDs
+}
+
+func (idx mapIndex) Prune(float64) int { return 0 }
+
+func (idx mapIndex) Sort() {}
+
+func (idx mapIndex) Posting(t trigram.T) ([]trigram.DocID, bool) {
+	docIDs, ok := idx.postings[t]
+	return docIDs, ok
+}
+
+func (idx mapIndex) Range(fn func(t trigram.T, docIDs []trigram.DocID)) {
+	for t, docIDs := range idx.postings {
+		fn(t, docIDs)
+	}
+}
+
+func (idx mapIndex) Clone() Index {
+	clone := mapIndex{postings: make(map[trigram.T][]trigram.DocID), queries: idx.queries}
+	for t, docIDs := range idx.postings {
+		clone.postings[t] = slices.Clone(docIDs)
+	}
+	return clone
+}
+
+// allDocIDs returns every internal ID registered with the Service's trigram index
+func allDocIDs(svc *Service) []trigram.DocID {
+	docIDs, _ := svc.idx.Posting(trigram.TAllDocIDs)
+	return docIDs
+}
+
+func TestWithIndex(t *testing.T) {
+	ctx := context.TODO()
+	var queries int
+	svc := NewService(WithIndex(func() Index { return newMapIndex(&queries) }))
+	want := NewService()
+	for _, s := range []*Service{svc, want} {
+		if err := s.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Delete(ctx, docOne.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	token := svc.Checkpoint()
+	if err := svc.Delete(ctx, docTwo.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Rollback(token); err != nil {
+		t.Fatal(err)
+	}
+	svc.Reindex()
+	if err := svc.Validate(); err != nil {
+		t.Errorf("Service.Validate() = %v", err)
+	}
+	for _, query := range []string{"sea shells", "pick", "fox", "she"} {
+		got, err := svc.Search(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantIDs, err := want.Search(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, wantIDs) {
+			t.Errorf("Service.Search(%q) = %v, want %v", query, got, wantIDs)
+		}
+	}
+	if queries == 0 {
+		t.Error("the Index passed to WithIndex was never queried")
+	}
+}
@@ -0,0 +1,68 @@
+package fulltext
+
+import (
+	"context"
+	"fmt"
+)
+
+// Op identifies the kind of mutation described by a Change
+type Op int
+
+const (
+	// OpUpsert indexes Text under ID, replacing any document already indexed under ID
+	OpUpsert Op = iota
+	// OpDelete removes the document indexed under ID
+	OpDelete
+)
+
+// Change describes a mutation of one document in the index, with enough data for
+// Apply to replay it against another Service
+type Change struct {
+	Op   Op
+	ID   uint64 // external ID of the document
+	Text string // the text indexed, after any truncation; empty for OpDelete
+}
+
+// ChangeSink receives a Change for each document mutated in a Service; see WithChangeSink
+type ChangeSink func(Change)
+
+// emit records a change to the indexed documents and delivers it to the sink, if any.
+// The caller must hold the write lock.
+func (svc *Service) emit(c Change) {
+	svc.generation++
+	if svc.changeSink != nil {
+		svc.changeSink(c)
+	}
+}
+
+// Apply replays a change received from the ChangeSink of another Service.  Unlike
+// Upsert, updates do not require PriorText, which is taken from the index, and deleting
+// a document that is not indexed is not an error, so a replica that missed changes can
+// still converge by applying later ones.
+func (svc *Service) Apply(ctx context.Context, c Change) error {
+	if c.ID == 0 {
+		return fmt.Errorf(`change ID must be greater than zero`)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	svc.Lock()
+	defer svc.Unlock()
+	switch c.Op {
+	case OpUpsert:
+		doc := Doc{ID: c.ID, Text: c.Text}
+		if docID, ok := svc.extIDs[c.ID]; ok {
+			doc.PriorText = svc.docs[docID].text
+		}
+		svc.upsert([]Doc{doc}, nil)
+	case OpDelete:
+		if docID, ok := svc.extIDs[c.ID]; ok {
+			svc.remove(docID)
+			svc.mutations++
+			svc.compactIfNeeded()
+		}
+	default:
+		return fmt.Errorf(`unknown change operation %d`, c.Op)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package fulltext
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestService_Apply_changeSink(t *testing.T) {
+	ctx := context.TODO()
+	var changes []Change
+	primary := NewService(WithChangeSink(func(c Change) { changes = append(changes, c) }), WithMergePolicy(MergeOverwrite))
+	if err := primary.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	update := Doc{ID: docTwo.ID, Text: "She sells sea glass", PriorText: docTwo.Text}
+	if err := primary.Upsert(ctx, []Doc{update}); err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.Delete(ctx, docOne.ID); err != nil {
+		t.Fatal(err)
+	}
+	other := NewService()
+	if err := other.Upsert(ctx, []Doc{{ID: 4, Text: "the lazy dog sleeps"}, {ID: docThree.ID, Text: "Peter picked peppers"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+	token := primary.Checkpoint()
+	if _, err := primary.DeleteWhere(ctx, func(id uint64) bool { return id > 2 }); err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.Upsert(ctx, []Doc{{ID: 5, Text: "garbage"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.Rollback(token); err != nil {
+		t.Fatal(err)
+	}
+	wantOps := []Op{OpUpsert, OpUpsert, OpUpsert, OpUpsert, OpDelete, OpUpsert, OpDelete, OpUpsert}
+	if len(changes) < len(wantOps) {
+		t.Fatalf("received %d changes, want at least %d", len(changes), len(wantOps))
+	}
+	for i, op := range wantOps {
+		if changes[i].Op != op {
+			t.Errorf("changes[%d].Op = %v, want %v", i, changes[i].Op, op)
+		}
+	}
+
+	replica := NewService()
+	for _, c := range changes {
+		if err := replica.Apply(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := replica.IDs(), primary.IDs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("replica IDs() = %v, want %v", got, want)
+	}
+	for _, query := range []string{"fox", "sea", "glass", "peter pep", "lazy", "garbage"} {
+		want, err := primary.Search(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := replica.Search(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("replica Search(%q) = %v, want %v", query, got, want)
+		}
+	}
+	if err := replica.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestService_Apply(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Apply(ctx, Change{Op: OpDelete, ID: 1}); err != nil {
+		t.Errorf("Apply() of a delete for a missing document = %v, want nil", err)
+	}
+	if err := svc.Apply(ctx, Change{Op: OpUpsert}); err == nil {
+		t.Error("Apply() should reject a zero ID")
+	}
+	if err := svc.Apply(ctx, Change{Op: Op(99), ID: 1}); err == nil {
+		t.Error("Apply() should reject an unknown operation")
+	}
+}
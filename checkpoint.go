@@ -0,0 +1,90 @@
+package fulltext
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+
+	"github.com/dgryski/go-trigram"
+)
+
+// checkpoint is the state of a Service captured by Checkpoint
+type checkpoint struct {
+	seq       int // orders checkpoints so that Rollback can discard later ones
+	docs      map[trigram.DocID]meta
+	extIDs    map[uint64]trigram.DocID
+	idx       Index
+	mutations int
+}
+
+// Checkpoint captures the contents of the index so that Rollback can restore them,
+// for example to undo a bulk update whose source data turns out to be corrupt part way
+// through.  The document maps and the trigram index's posting lists are copied, because
+// updates modify them in place, but suffix arrays are never modified once built and are
+// shared with the checkpoint.  A checkpoint therefore costs about as much memory as the
+// trigram index plus a few words per document, and also keeps the suffix arrays of
+// documents updated or deleted since it was taken from being garbage collected.  A
+// checkpoint lives until it is restored with Rollback or discarded with Release, so
+// callers must Release checkpoints they no longer need.  The index is write locked
+// while the copy is made.
+func (svc *Service) Checkpoint() (token string) {
+	svc.Lock()
+	defer svc.Unlock()
+	svc.checkpointSeq++
+	if svc.checkpoints == nil {
+		svc.checkpoints = make(map[string]checkpoint)
+	}
+	token = strconv.Itoa(svc.checkpointSeq)
+	svc.checkpoints[token] = checkpoint{
+		seq:       svc.checkpointSeq,
+		docs:      maps.Clone(svc.docs),
+		extIDs:    maps.Clone(svc.extIDs),
+		idx:       svc.idx.Clone(),
+		mutations: svc.mutations,
+	}
+	return token
+}
+
+// Rollback restores the index to its contents when Checkpoint returned token, undoing
+// every Upsert, Delete, Merge and Reindex since.  A ChangeSink receives the changes
+// needed to bring a replica to the restored state.  The checkpoint is consumed, and so are
+// any checkpoints taken after it, since they describe states that no longer exist;
+// earlier checkpoints remain valid.
+func (svc *Service) Rollback(token string) error {
+	svc.Lock()
+	defer svc.Unlock()
+	cp, ok := svc.checkpoints[token]
+	if !ok {
+		return fmt.Errorf(`checkpoint '%s' does not exist or has already been released`, token)
+	}
+	for docID, doc := range svc.docs {
+		if cp.docs[docID].sa != doc.sa {
+			svc.forget(doc)
+		}
+		if _, ok := cp.extIDs[doc.id]; !ok {
+			svc.emit(Change{Op: OpDelete, ID: doc.id})
+		}
+	}
+	for docID, doc := range cp.docs {
+		if current, ok := svc.docs[docID]; !ok || current.text != doc.text {
+			svc.emit(Change{Op: OpUpsert, ID: doc.id, Text: doc.text})
+		}
+	}
+	svc.docs, svc.extIDs, svc.idx, svc.mutations = cp.docs, cp.extIDs, cp.idx, cp.mutations
+	svc.generation++
+	svc.epoch++
+	for t, later := range svc.checkpoints {
+		if later.seq >= cp.seq {
+			delete(svc.checkpoints, t)
+		}
+	}
+	return nil
+}
+
+// Release discards the checkpoint identified by token without restoring it, freeing
+// the memory it holds.  Releasing an unknown token does nothing.
+func (svc *Service) Release(token string) {
+	svc.Lock()
+	defer svc.Unlock()
+	delete(svc.checkpoints, token)
+}
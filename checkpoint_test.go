@@ -0,0 +1,78 @@
+package fulltext
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestService_Rollback(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	queries := []string{"fox", "sea", "pe", "garbage"}
+	search := func() map[string][]uint64 {
+		results := make(map[string][]uint64, len(queries))
+		for _, query := range queries {
+			got, err := svc.Search(ctx, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			results[query] = got
+		}
+		return results
+	}
+	want := search()
+	token := svc.Checkpoint()
+	later := svc.Checkpoint()
+	garbage := []Doc{
+		{ID: docTwo.ID, Text: "garbage", PriorText: docTwo.Text},
+		{ID: 4, Text: "more garbage about the sea"},
+	}
+	if err := svc.Upsert(ctx, garbage); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Delete(ctx, docOne.ID); err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(search(), want) {
+		t.Fatal("Search() results did not change after upserting garbage")
+	}
+	if err := svc.Rollback(token); err != nil {
+		t.Fatal(err)
+	}
+	if got := search(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Search() after Rollback = %v, want %v", got, want)
+	}
+	if err := svc.Validate(); err != nil {
+		t.Error(err)
+	}
+	if err := svc.Rollback(token); err == nil {
+		t.Error("Rollback() should fail for a checkpoint already restored")
+	}
+	if err := svc.Rollback(later); err == nil {
+		t.Error("Rollback() should fail for a checkpoint taken after the one restored")
+	}
+	// the index remains usable after a rollback
+	if err := svc.Upsert(ctx, []Doc{{ID: 4, Text: "sea glass"}}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := svc.Search(ctx, "sea")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{docTwo.ID, docThree.ID, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Search() after Upsert = %v, want %v", got, want)
+	}
+}
+
+func TestService_Release(t *testing.T) {
+	svc := NewService()
+	token := svc.Checkpoint()
+	svc.Release(token)
+	if err := svc.Rollback(token); err == nil {
+		t.Error("Rollback() should fail for a released checkpoint")
+	}
+}
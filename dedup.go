@@ -0,0 +1,138 @@
+package fulltext
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/dgryski/go-trigram"
+)
+
+// fingerprintSize is the number of minhash values in a document fingerprint.  The
+// similarity of two fingerprints estimates the Jaccard index of the documents' trigram
+// sets with a standard error of about 1/sqrt(fingerprintSize).
+const fingerprintSize = 64
+
+// DefaultDedupSimilarity is the similarity at which SearchOptions.Dedup collapses results
+// unless SearchOptions.DedupSimilarity is set.  It tolerates small edits, such as a
+// changed word in a sentence of a dozen.
+const DefaultDedupSimilarity = 0.8
+
+// DuplicateError reports a document that Upsert rejected as a near-duplicate of another
+// document; see WithDedupThreshold
+type DuplicateError struct {
+	ID         uint64  // external ID of the rejected document
+	ExistingID uint64  // external ID of the document it duplicates
+	Similarity float64 // estimated Jaccard index of the two documents' trigram sets
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf(`document %d is a near-duplicate of document %d (similarity %.2f)`, e.ID, e.ExistingID, e.Similarity)
+}
+
+// fingerprint returns the minhash signature of a trigram set: for each of
+// fingerprintSize hash functions, the smallest hash of any of the trigrams
+func fingerprint(tGrams map[trigram.T]struct{}) []uint32 {
+	sig := make([]uint32, fingerprintSize)
+	for i := range sig {
+		sig[i] = math.MaxUint32
+	}
+	for t := range tGrams {
+		for i := range sig {
+			if h := mix(uint64(t) + uint64(i)*0x9E3779B97F4A7C15); h < sig[i] {
+				sig[i] = h
+			}
+		}
+	}
+	return sig
+}
+
+// mix is the splitmix64 finalizer, truncated to 32 bits
+func mix(x uint64) uint32 {
+	x = (x ^ (x >> 30)) * 0xBF58476D1CE4E5B9
+	x = (x ^ (x >> 27)) * 0x94D049BB133111EB
+	return uint32(x ^ (x >> 31))
+}
+
+// similarity returns the fraction of positions at which two fingerprints agree
+func similarity(a, b []uint32) float64 {
+	var same int
+	for i := range a {
+		if a[i] == b[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(a))
+}
+
+// fingerprint returns the document's fingerprint, computing it when the document was
+// indexed without one
+func (m meta) fingerprint() []uint32 {
+	if m.sig != nil {
+		return m.sig
+	}
+	return fingerprint(trigramSet(m.words()))
+}
+
+// checkDuplicates returns a *DuplicateError if any of docs is a near-duplicate of a
+// document indexed under another ID or of an earlier document in docs.  Candidates are
+// the documents sharing at least one trigram.  The caller must hold the lock.
+func (svc *Service) checkDuplicates(docs []Doc) error {
+	if svc.dedupThreshold <= 0 {
+		return nil
+	}
+	type pending struct {
+		id  uint64
+		sig []uint32
+	}
+	var batch []pending
+	for _, doc := range docs {
+		_, words := svc.analyze(svc.limit(doc.Text), nil)
+		tGrams := trigramSet(words)
+		if len(tGrams) == 0 {
+			continue
+		}
+		sig := fingerprint(tGrams)
+		for _, docID := range svc.similarCandidates(tGrams) {
+			existing, ok := svc.docs[docID]
+			if !ok || existing.id == doc.ID {
+				continue
+			}
+			if s := similarity(sig, existing.fingerprint()); s >= svc.dedupThreshold {
+				return &DuplicateError{ID: doc.ID, ExistingID: existing.id, Similarity: s}
+			}
+		}
+		for _, p := range batch {
+			if s := similarity(sig, p.sig); p.id != doc.ID && s >= svc.dedupThreshold {
+				return &DuplicateError{ID: doc.ID, ExistingID: p.id, Similarity: s}
+			}
+		}
+		batch = append(batch, pending{id: doc.ID, sig: sig})
+	}
+	return nil
+}
+
+// representatives returns the external IDs of the documents kept when near duplicates
+// among docs are collapsed into the document with the lowest external ID
+func representatives(docs []meta, threshold float64) map[uint64]bool {
+	if threshold <= 0 {
+		threshold = DefaultDedupSimilarity
+	}
+	docs = slices.Clone(docs)
+	sort.Slice(docs, func(i, j int) bool { return docs[i].id < docs[j].id })
+	keep := make(map[uint64]bool, len(docs))
+	var kept [][]uint32
+docLoop:
+	for _, doc := range docs {
+		sig := doc.fingerprint()
+		for _, k := range kept {
+			if similarity(sig, k) >= threshold {
+				continue docLoop
+			}
+		}
+		kept = append(kept, sig)
+		keep[doc.id] = true
+	}
+	return keep
+}
@@ -0,0 +1,132 @@
+package fulltext
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestService_Upsert_dedup(t *testing.T) {
+	ctx := context.TODO()
+	original := Doc{ID: 10, Text: "Peter Piper picked a peck of pickled peppers while jumping over the sea shells"}
+	nearDuplicate := Doc{ID: 11, Text: "Peter Piper picked a peck of pickled peppers while hopping over the sea shells"}
+	tests := []struct {
+		name    string
+		setup   []Doc
+		docs    []Doc
+		wantDup *DuplicateError
+	}{
+		{
+			name:    "a near-duplicate of an indexed document is rejected",
+			setup:   []Doc{original, docTwo},
+			docs:    []Doc{nearDuplicate},
+			wantDup: &DuplicateError{ID: nearDuplicate.ID, ExistingID: original.ID},
+		},
+		{
+			name:    "a near-duplicate within the batch is rejected",
+			docs:    []Doc{docOne, original, nearDuplicate},
+			wantDup: &DuplicateError{ID: nearDuplicate.ID, ExistingID: original.ID},
+		},
+		{
+			name:  "a distinct document is accepted",
+			setup: []Doc{original},
+			docs:  []Doc{docOne, docTwo},
+		},
+		{
+			name:  "updating a document does not conflict with its old text",
+			setup: []Doc{original},
+			docs:  []Doc{{ID: original.ID, Text: nearDuplicate.Text, PriorText: original.Text}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewService(WithDedupThreshold(0.8))
+			if err := svc.Upsert(ctx, tt.setup); err != nil {
+				t.Fatal(err)
+			}
+			err := svc.Upsert(ctx, tt.docs)
+			if tt.wantDup == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var dup *DuplicateError
+			if !errors.As(err, &dup) {
+				t.Fatalf("Service.Upsert() error = %v, want a *DuplicateError", err)
+			}
+			if dup.ID != tt.wantDup.ID || dup.ExistingID != tt.wantDup.ExistingID || dup.Similarity < 0.8 {
+				t.Errorf("Service.Upsert() error = %+v, want %+v", dup, tt.wantDup)
+			}
+			if got := svc.DocCount(); got != len(tt.setup) {
+				t.Errorf("Service.DocCount() = %d, want %d after a rejected Upsert", got, len(tt.setup))
+			}
+		})
+	}
+}
+
+func Test_similarity(t *testing.T) {
+	a := trigramSet([]string{"_peter", "_piper", "_picked", "_a", "_peck", "_of", "_pickled", "_peppers"})
+	b := trigramSet([]string{"_peter", "_piper", "_picked", "_a", "_peck", "_of", "_pickled", "_pepper"})
+	c := trigramSet([]string{"_she", "_sells", "_sea", "_shells"})
+	if got := similarity(fingerprint(a), fingerprint(a)); got != 1 {
+		t.Errorf("similarity() of identical sets = %v, want 1", got)
+	}
+	if got, want := similarity(fingerprint(a), fingerprint(b)), jaccard(a, b); got < want-0.2 || got > want+0.2 {
+		t.Errorf("similarity() = %v, want about %v", got, want)
+	}
+	if got := similarity(fingerprint(a), fingerprint(c)); got > 0.2 {
+		t.Errorf("similarity() of disjoint sets = %v, want about 0", got)
+	}
+}
+
+func TestService_SearchWith_dedup(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	docs := []Doc{
+		{ID: 12, Text: "Peter Piper picked a peck of pickled peppers from the garden patch today"},
+		{ID: 5, Text: "Peter Piper picked a peck of pickled peppers from the garden patch yesterday"},
+		docThree,
+		{ID: 20, Text: "Peter Piper picked a peck of pickled peppers from the garden patch today"},
+	}
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		opts SearchOptions
+		want []uint64
+	}{
+		{
+			name: "without Dedup every copy is returned",
+			want: []uint64{12, 5, 3, 20},
+		},
+		{
+			name: "Dedup keeps the lowest ID of the near duplicates in its place",
+			opts: SearchOptions{Dedup: true},
+			want: []uint64{5, 3},
+		},
+		{
+			name: "a stricter similarity only collapses exact copies",
+			opts: SearchOptions{Dedup: true, DedupSimilarity: 1},
+			want: []uint64{12, 5, 3},
+		},
+		{
+			name: "Dedup applies before ordering",
+			opts: SearchOptions{Dedup: true, Order: OrderIDDesc},
+			want: []uint64{5, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := svc.SearchWith(ctx, "peter pickled", tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.SearchWith() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
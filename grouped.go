@@ -0,0 +1,65 @@
+package fulltext
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/dgryski/go-trigram"
+)
+
+// SearchGrouped performs the same search as Search, but groups the matching documents
+// by the indexed words that matched the query, for typeahead UIs that present
+// suggestions under headings such as "pickled" and "peppers".  Each key is a word as
+// returned by Tokens, and its value lists, in ascending order, the external IDs of
+// matching documents containing that word.  A document appears under every word that
+// matched any query word, or any of its synonyms, so it may appear in several groups.
+func (svc *Service) SearchGrouped(ctx context.Context, query string) (map[string][]uint64, error) {
+	if err := svc.acquireSearch(); err != nil {
+		return nil, err
+	}
+	defer svc.releaseSearch()
+	q, err := svc.newQuery(query, SearchOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer q.release()
+	svc.RLock()
+	defer svc.RUnlock()
+	groups := make(map[string][]uint64)
+	err = svc.verify(ctx, svc.queryCandidates(q), q.matches, func(_ trigram.DocID, doc meta) bool {
+		for _, word := range q.matchedWords(doc) {
+			groups[word] = append(groups[word], doc.id)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, docIDs := range groups {
+		sort.Slice(docIDs, func(i, j int) bool { return docIDs[i] < docIDs[j] })
+	}
+	return groups, nil
+}
+
+// matchedWords returns the distinct indexed words of the document in which q's words,
+// or their synonyms, match, unescaped and without their anchors
+func (q *searchQuery) matchedWords(doc meta) []string {
+	b := doc.sa.Bytes()
+	seen := make(map[string]struct{})
+	var words []string
+	for _, word := range q.alternatives() {
+		for _, offset := range doc.sa.Lookup([]byte(word), -1) {
+			// the matched word runs between the delimiters surrounding the offset
+			start := bytes.LastIndexByte(b[:offset+1], saDelim[0]) + 1
+			end := start + bytes.IndexByte(b[start:], saDelim[0])
+			matched := unescaper.Replace(strings.TrimPrefix(string(b[start:end]), `_`))
+			if _, ok := seen[matched]; !ok {
+				seen[matched] = struct{}{}
+				words = append(words, matched)
+			}
+		}
+	}
+	return words
+}
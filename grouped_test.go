@@ -0,0 +1,52 @@
+package fulltext
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestService_SearchGrouped(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		query string
+		want  map[string][]uint64
+	}{
+		{
+			name:  "each word of docThree matching the prefix is a group",
+			query: "pic",
+			want:  map[string][]uint64{"picked": {3}, "pickled": {3}},
+		},
+		{
+			name:  "every query word contributes groups",
+			query: "pickl pep",
+			want:  map[string][]uint64{"pickled": {3}, "peppers": {3}},
+		},
+		{
+			name:  "documents sharing a word share its group",
+			query: "sh",
+			want:  map[string][]uint64{"she": {2}, "shells": {2, 3}, "shore": {2}},
+		},
+		{
+			name:  "no matches",
+			query: "pickled fox",
+			want:  map[string][]uint64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.SearchGrouped(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.SearchGrouped(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package fulltext
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/dgryski/go-trigram"
+)
+
+// Ready reports whether the Service is ready to serve searches, for use as a readiness
+// probe.  A Service is ready from the moment NewService returns, unless it was created
+// with WithInitialLoad, in which case it becomes ready once UpsertReader first completes
+// without error or MarkReady is called.  A ready Service is briefly not ready while
+// Reindex, or compaction triggered by WithCompactThreshold, holds the write lock, since
+// searches wait until it finishes; background compaction does not affect readiness.
+// Ready never blocks.
+func (svc *Service) Ready() bool {
+	return svc.loaded.Load() && svc.rebuilding.Load() == 0
+}
+
+// MarkReady marks the initial load of a Service created with WithInitialLoad as
+// complete, for loaders other than UpsertReader, such as replaying changes with Apply.
+// Calling it on a Service that is already ready does nothing.
+func (svc *Service) MarkReady() {
+	svc.loaded.Store(true)
+}
+
+// Healthy performs a cheap self-check, for use as a liveness probe, returning an error
+// describing the first inconsistency found.  It checks that the document maps agree in
+// size and that a canary document, chosen at random, is found by a lookup of one of its
+// own words in both the trigram index and its suffix array, which exercises the same
+// steps as a search.  Unlike Validate it does not examine every document, so it may
+// miss corruption affecting only some of them.  An empty index is healthy.  The index
+// is read locked during the check, which may rebuild the canary's suffix array when
+// WithMaxSuffixArrays is in effect.
+func (svc *Service) Healthy() error {
+	svc.RLock()
+	defer svc.RUnlock()
+	if len(svc.docs) != len(svc.extIDs) {
+		return fmt.Errorf(`%d documents are indexed but %d external IDs are mapped`, len(svc.docs), len(svc.extIDs))
+	}
+	for docID, doc := range svc.docs {
+		for _, word := range doc.words() {
+			tGrams := trigram.Extract(word, nil)
+			if len(tGrams) == 0 {
+				continue
+			}
+			if !slices.Contains(svc.idx.QueryTrigrams(tGrams), docID) {
+				return fmt.Errorf(`canary document %d is not a candidate for its word %q`, doc.id, unescaper.Replace(word))
+			}
+			if doc.sa.Lookup([]byte(word), 1) == nil {
+				return fmt.Errorf(`canary document %d does not contain its word %q`, doc.id, unescaper.Replace(word))
+			}
+			return nil
+		}
+		// the document has no words long enough to look up, so try another
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package fulltext
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestService_Ready(t *testing.T) {
+	ctx := context.TODO()
+	if !NewService().Ready() {
+		t.Error("Service.Ready() = false without WithInitialLoad")
+	}
+	svc := NewService(WithInitialLoad())
+	if svc.Ready() {
+		t.Error("Service.Ready() = true before the initial load")
+	}
+	if err := svc.Healthy(); err != nil {
+		t.Errorf("Service.Healthy() = %v for an empty index", err)
+	}
+	// simulate a slow load by feeding UpsertReader through a pipe
+	r, w := io.Pipe()
+	loaded := make(chan error)
+	go func() {
+		loaded <- svc.UpsertReader(ctx, r, bufio.ScanLines, func(text string) uint64 { return uint64(len(text)) })
+	}()
+	if _, err := io.WriteString(w, docOne.Text+"\n"+docTwo.Text+"\n"); err != nil {
+		t.Fatal(err)
+	}
+	if svc.Ready() {
+		t.Error("Service.Ready() = true during the initial load")
+	}
+	w.Close()
+	if err := <-loaded; err != nil {
+		t.Fatal(err)
+	}
+	if !svc.Ready() {
+		t.Error("Service.Ready() = false after the initial load")
+	}
+	if err := svc.Healthy(); err != nil {
+		t.Errorf("Service.Healthy() = %v after the initial load", err)
+	}
+	// a failed load leaves the Service not ready until MarkReady
+	failed := NewService(WithInitialLoad())
+	err := failed.UpsertReader(ctx, strings.NewReader(docOne.Text), bufio.ScanLines, func(string) uint64 { return 0 })
+	if err == nil {
+		t.Fatal("Service.UpsertReader() should reject a zero ID")
+	}
+	if failed.Ready() {
+		t.Error("Service.Ready() = true after a failed load")
+	}
+	failed.MarkReady()
+	if !failed.Ready() {
+		t.Error("Service.Ready() = false after MarkReady")
+	}
+}
+
+func TestService_Healthy(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	// enough documents with distinct words that not every trigram is pruned
+	var docs []Doc
+	for i := 1; i <= 20; i++ {
+		docs = append(docs, Doc{ID: uint64(i), Text: fmt.Sprintf("word%03d", i)})
+	}
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Healthy(); err != nil {
+		t.Fatalf("Service.Healthy() = %v", err)
+	}
+	// lose every document's postings, whichever is chosen as the canary
+	for docID, doc := range svc.docs {
+		for _, word := range doc.words() {
+			svc.unindex(word, docID)
+		}
+	}
+	if err := svc.Healthy(); err == nil {
+		t.Error("Service.Healthy() did not detect missing postings")
+	}
+	delete(svc.extIDs, 1)
+	if err := svc.Healthy(); err == nil {
+		t.Error("Service.Healthy() did not detect an unmapped document")
+	}
+}
@@ -6,26 +6,96 @@ package fulltext
 import (
 	"context"
 	"fmt"
-	"index/suffixarray"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	"github.com/dgryski/go-trigram"
-	"github.com/nycmonkey/stringy"
 )
 
 const (
 	saDelim = "\x00" // suffixArray delimiter; see https://eli.thegreenplace.net/2016/suffix-arrays-in-the-go-standard-library/
 )
 
-var (
-	replacer = strings.NewReplacer(`-`, ` `, `_`, ` `, `:`, ` `, `|`, ` `)
-)
-
 // meta holds metadata about an indexed document
 type meta struct {
-	sa *suffixarray.Index // used to remove false positives from trigram index results
-	id uint64             // external document ID
+	sa        *suffixArray // used to remove false positives from trigram index results
+	id        uint64       // external document ID
+	updatedAt time.Time    // when the document was last upserted
+	text      string       // the original text passed to Upsert
+	spans     []Span       // where each word was found in text; nil unless the tokenizer is a SpanTokenizer
+	sig       []uint32     // minhash fingerprint of the document's trigrams; nil unless deduplicating
+}
+
+// words returns the analyzed words stored in the document's suffix array
+func (m meta) words() []string {
+	entries := m.entries()
+	for i, entry := range entries {
+		if isSecondary(entry) {
+			// secondary forms are stored after every word
+			return entries[:i]
+		}
+	}
+	return entries
+}
+
+// entries returns everything indexed for the document: its analyzed words followed by
+// their secondary forms, if any
+func (m meta) entries() []string {
+	return strings.FieldsFunc(string(m.sa.Bytes()), func(r rune) bool { return r == rune(saDelim[0]) })
+}
+
+// liveDocIDs returns the internal IDs of every document in the index, in ascending order
+func (svc *Service) liveDocIDs() []trigram.DocID {
+	docIDs := make([]trigram.DocID, 0, len(svc.docs))
+	for docID := range svc.docs {
+		docIDs = append(docIDs, docID)
+	}
+	sort.Slice(docIDs, func(i, j int) bool { return docIDs[i] < docIDs[j] })
+	return docIDs
+}
+
+// plan orders words from rarest to most common, estimating each word's document
+// frequency from the shortest posting list among its trigrams.  The trigram library
+// already intersects posting lists rarest-first when generating candidates; verifying
+// the rarest word first as well means false positives are usually rejected by the
+// first suffix array lookup instead of the last.  Pruned trigrams are treated as
+// occurring in every document.
+func (svc *Service) plan(words []string) []string {
+	freq := make(map[string]int, len(words))
+	var tGrams []trigram.T
+	for _, word := range words {
+		tGrams = trigram.Extract(strings.Trim(word, saDelim), tGrams[:0])
+		min := len(svc.docs)
+		for _, t := range tGrams {
+			posting, ok := svc.idx.Posting(t)
+			if !ok {
+				min = 0
+				break
+			}
+			if posting != nil && len(posting) < min {
+				min = len(posting)
+			}
+		}
+		freq[word] = min
+	}
+	sort.SliceStable(words, func(i, j int) bool { return freq[words[i]] < freq[words[j]] })
+	return words
+}
+
+// contains reports whether every word is present in the document.  Trigram
+// candidates that fail this check are false positives.
+func (m meta) contains(words []string) bool {
+	for _, word := range words {
+		if m.sa.Lookup([]byte(word), 1) == nil {
+			return false
+		}
+	}
+	return true
 }
 
 // Doc is a document to be indexed
@@ -37,19 +107,68 @@ type Doc struct {
 
 // Service implements pb.FulltextServiceServer
 type Service struct {
-	docs         map[trigram.DocID]meta
-	extIDs       map[uint64]trigram.DocID // tracks the IDs already in the index
-	idx          trigram.Index            // allows lookup by name
-	sync.RWMutex                          // protects docs and idx
+	docs             map[trigram.DocID]meta
+	extIDs           map[uint64]trigram.DocID // tracks the IDs already in the index
+	idx              Index                    // allows lookup by name
+	newIndex         func() Index             // creates the empty trigram index used by NewService and Reindex
+	mergePolicy      MergePolicy              // how Merge resolves external ID collisions
+	now              func() time.Time         // clock used to timestamp upserts
+	compactThreshold int                      // updates and deletes that trigger an automatic Reindex; zero disables
+	compactInterval  time.Duration            // how often to compact in the background; zero disables
+	expectedDocs     int                      // the number of documents the maps are initially sized for
+	canonical        bool                     // whether documents are ordered by external ID; see WithCanonicalOrder
+	tokenizer        Tokenizer                // splits text into words at index and query time
+	saCache          *saCache                 // bounds resident suffix arrays; nil when unlimited
+	synonyms         map[string][]string      // query words mapped to the words that may stand in for them
+	secondary        func(word string) string // derives the secondary form of each word; may be nil
+	repeatKeep       int                      // letters kept from each run of three or more; zero disables folding
+	suffixes         bool                     // whether reversed words are indexed for AnchorSuffix queries
+	unanchored       bool                     // whether words are indexed without the leading anchor; see WithSubstringMatching
+	maxDocBytes      int                      // the longest text indexed in full; zero when unlimited
+	maxSABytes       int                      // the largest document given a suffix array; zero when unlimited
+	lengthPolicy     LengthPolicy             // how texts longer than maxDocBytes are handled
+	checkpoints      map[string]checkpoint    // captured by Checkpoint, keyed by token
+	checkpointSeq    int                      // the sequence number of the latest checkpoint
+	changeSink       ChangeSink               // receives a Change for each mutated document; may be nil
+	progressEvery    int                      // the number of documents between progress reports
+	progressFn       func(done int)           // receives progress reports from Upsert and UpsertReader; may be nil
+	minQueryWordLen  int                      // query words with fewer runes are ignored
+	maxQueryBreadth  float64                  // the largest fraction of documents a query may match; zero disables
+	searchSlots      chan struct{}            // holds a token for each search in progress; nil when unlimited
+	normalizer       func(string) string      // applied to text before tokenizing; may be nil
+	dedupThreshold   float64                  // similarity at which Upsert rejects near-duplicates; zero disables
+	mutations        int                      // updates and deletes since the last Reindex
+	generation       uint64                   // incremented by every change to the indexed documents
+	epoch            uint32                   // incremented whenever internal IDs are reassigned; recorded in page cursors
+	closing          chan struct{}            // closed by Close to stop background compaction; nil without it
+	compacted        chan struct{}            // closed when background compaction has stopped
+	closeOnce        sync.Once                // makes Close idempotent
+	initialLoad      bool                     // whether the Service waits for a load before it is ready
+	loaded           atomic.Bool              // whether the initial load, if any, has completed
+	rebuilding       atomic.Int32             // the number of Reindex calls in progress
+	sync.RWMutex                              // protects docs and idx
 }
 
 // NewService initializes a fulltext index service
-func NewService() *Service {
-	return &Service{
-		docs:   make(map[trigram.DocID]meta),
-		extIDs: make(map[uint64]trigram.DocID),
-		idx:    trigram.NewIndex(nil),
+func NewService(opts ...Option) *Service {
+	svc := &Service{
+		newIndex:  NewTrigramIndex,
+		now:       time.Now,
+		tokenizer: DefaultTokenizer,
 	}
+	for _, opt := range opts {
+		opt(svc)
+	}
+	svc.loaded.Store(!svc.initialLoad)
+	svc.docs = make(map[trigram.DocID]meta, svc.expectedDocs)
+	svc.extIDs = make(map[uint64]trigram.DocID, svc.expectedDocs)
+	svc.idx = svc.newIndex()
+	svc.synonyms = normalizeSynonyms(svc.synonyms, svc.tokenize)
+	if svc.compactInterval > 0 {
+		svc.closing, svc.compacted = make(chan struct{}), make(chan struct{})
+		go svc.compactEvery(svc.compactInterval)
+	}
+	return svc
 }
 
 // DocCount returns the number of documents in the index
@@ -59,96 +178,411 @@ func (svc *Service) DocCount() int {
 	return len(svc.docs)
 }
 
-func analyze(text string) (tGrams []trigram.T, words []string) {
-	words = stringy.Analyze(replacer.Replace(text))
-	// prefix the start of each token with an underscore to ensure we only match from the beginning of words
-	if len(words) == 0 {
-		return
+// IDs returns the external IDs of every document in the index, in ascending order
+func (svc *Service) IDs() []uint64 {
+	ids := make([]uint64, 0, svc.DocCount())
+	svc.Range(func(id uint64) bool {
+		ids = append(ids, id)
+		return true
+	})
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// InternalID returns the trigram.DocID under which the document with the given
+// external ID is currently indexed, for callers analyzing the trigram index directly.
+// Internal IDs change whenever a document is updated and when the index is rebuilt.
+func (svc *Service) InternalID(id uint64) (docID trigram.DocID, ok bool) {
+	svc.RLock()
+	defer svc.RUnlock()
+	docID, ok = svc.extIDs[id]
+	return
+}
+
+// Range calls fn for the external ID of every document in the index, in no particular
+// order, until fn returns false.  The index is read locked while Range runs, so fn must
+// not modify the index.
+func (svc *Service) Range(fn func(id uint64) bool) {
+	svc.RLock()
+	defer svc.RUnlock()
+	for id := range svc.extIDs {
+		if !fn(id) {
+			return
+		}
+	}
+}
+
+// Token is a word indexed for a document
+type Token struct {
+	Word string // the analyzed word, as matched by queries
+	Span        // where the word was found in the original text
+}
+
+// Tokens returns the words indexed for the document with the given external ID, in
+// document order, along with where each was found in the text passed to Upsert, so
+// that callers can recover the exact source substring (with its original case and
+// punctuation) for highlighting.  Spans are zero when the Service's Tokenizer is not
+// a SpanTokenizer or when WithNormalizer changed the text.  ok is false if the
+// document is not indexed.
+func (svc *Service) Tokens(id uint64) (tokens []Token, ok bool) {
+	svc.RLock()
+	defer svc.RUnlock()
+	docID, ok := svc.extIDs[id]
+	if !ok {
+		return nil, false
+	}
+	doc := svc.docs[docID]
+	words := doc.words()
+	tokens = make([]Token, len(words))
+	for i, word := range words {
+		tokens[i].Word = unescaper.Replace(strings.TrimPrefix(word, `_`))
+		if i < len(doc.spans) {
+			tokens[i].Span = doc.spans[i]
+		}
 	}
-	for i := 0; i < len(words); i++ {
+	return tokens, true
+}
+
+// ChangedSince returns the external IDs of documents upserted at or after t,
+// ordered from least to most recently updated
+func (svc *Service) ChangedSince(t time.Time) []uint64 {
+	svc.RLock()
+	defer svc.RUnlock()
+	var changed []meta
+	for _, doc := range svc.docs {
+		if !doc.updatedAt.Before(t) {
+			changed = append(changed, doc)
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool {
+		if !changed[i].updatedAt.Equal(changed[j].updatedAt) {
+			return changed[i].updatedAt.Before(changed[j].updatedAt)
+		}
+		return changed[i].id < changed[j].id
+	})
+	docIDs := make([]uint64, len(changed))
+	for i, doc := range changed {
+		docIDs[i] = doc.id
+	}
+	return docIDs
+}
+
+// escaper rewrites the bytes that have special meaning in suffix arrays, the word
+// anchor and the delimiter, to bytes that never occur in valid UTF-8.  Because each
+// byte maps to exactly one other byte, prefix, suffix and substring relationships
+// between words are preserved, while words containing literal underscores or NUL
+// bytes can no longer be mistaken for anchors or word boundaries.
+var (
+	escaper   = strings.NewReplacer(`_`, "\xfe", saDelim, "\xff")
+	unescaper = strings.NewReplacer("\xfe", `_`, "\xff", saDelim)
+)
+
+// escape rewrites words in place so that none contains the word anchor or the suffix
+// array delimiter.  Invalid UTF-8 is first replaced with U+FFFD so that the escaped
+// bytes are unambiguous.
+func escape(words []string) []string {
+	for i, word := range words {
+		if !utf8.ValidString(word) {
+			word = strings.ToValidUTF8(word, "\uFFFD")
+		}
+		words[i] = escaper.Replace(word)
+	}
+	return words
+}
+
+// tokenize normalizes text and splits it into escaped words using the Service's Tokenizer
+func (svc *Service) tokenize(text string) []string {
+	return escape(svc.fold(svc.tokenizer.Tokenize(svc.normalize(text))))
+}
+
+// normalize applies the Service's normalizer, if any, to text
+func (svc *Service) normalize(text string) string {
+	if svc.normalizer == nil {
+		return text
+	}
+	return svc.normalizer(text)
+}
+
+// tGramPool recycles the trigram slices built while analyzing text, which are only
+// needed until candidates have been generated or postings added.  It holds pointers
+// so that returning a slice to the pool does not allocate.
+var tGramPool = sync.Pool{New: func() any { return new([]trigram.T) }}
+
+// analyze splits text into anchored words and appends their trigrams to tGrams,
+// which may be nil or a slice borrowed from tGramPool
+func (svc *Service) analyze(text string, tGrams []trigram.T) ([]trigram.T, []string) {
+	words := svc.tokenize(text)
+	return svc.withSuffixes(svc.anchor(words, tGrams), words), words
+}
+
+// analyzeSpans is like analyze, but also returns the span of text each word was
+// extracted from when the tokenizer is a SpanTokenizer.  Spans are only known when
+// normalization leaves text unchanged, since they would otherwise locate words in the
+// normalized text rather than in text.
+func (svc *Service) analyzeSpans(text string, tGrams []trigram.T) ([]trigram.T, []string, []Span) {
+	st, ok := svc.tokenizer.(SpanTokenizer)
+	normalized := svc.normalize(text)
+	if !ok || normalized != text {
+		tGrams, words := svc.analyze(text, tGrams)
+		return tGrams, words, nil
+	}
+	words, spans := st.TokenizeSpans(text)
+	words = escape(svc.fold(words))
+	return svc.withSuffixes(svc.anchor(words, tGrams), words), words, spans
+}
+
+// anchor prefixes each word in place and appends the trigrams of the prefixed words to
+// tGrams.  Words are left as they are when WithSubstringMatching is enabled.
+func (svc *Service) anchor(words []string, tGrams []trigram.T) []trigram.T {
+	// prefix the start of each token with an underscore to ensure we only match from the beginning of words
+	for i := 0; i < len(words) && !svc.unanchored; i++ {
 		words[i] = `_` + words[i]
 	}
 	for _, tok := range words {
 		tGrams = trigram.Extract(tok, tGrams)
 	}
-	return
+	return tGrams
 }
 
-// Search performs a fulltext search suitable for a typeahead search box.
-// The returned docIDs are the external IDs provided at time of indexing.
-func (svc *Service) Search(ctx context.Context, query string) (docIDs []uint64, err error) {
-	tGrams, words := analyze(query)
-	if len(tGrams) == 0 {
-		err = fmt.Errorf(`query '%s' does not have enough content`, query)
-		return
+// suffixForm returns the reversed, trailing-anchored form of an unanchored word, whose
+// trigrams are indexed when WithSuffixIndex is enabled.  Reversing the word turns a
+// suffix query into a prefix query against the reversed form.
+func suffixForm(word string) string {
+	b := make([]byte, len(word)+1)
+	b[0] = saDelim[0]
+	for i := 0; i < len(word); i++ {
+		b[len(word)-i] = word[i]
 	}
-	svc.RLock()
-	defer svc.RUnlock()
-	candidates := svc.idx.QueryTrigrams(tGrams)
-	docIDs = make([]uint64, 0, len(candidates))
-candidateLoop:
-	for _, docID := range candidates {
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		default:
-		}
-		doc, ok := svc.docs[docID]
-		if !ok {
+	return string(b)
+}
+
+// withSuffixes appends the trigrams of the suffix forms of anchored words to tGrams
+// when the suffix index is enabled
+func (svc *Service) withSuffixes(tGrams []trigram.T, words []string) []trigram.T {
+	if !svc.suffixes {
+		return tGrams
+	}
+	for _, word := range words {
+		if isSecondary(word) {
 			continue
 		}
-		for _, word := range words {
-			if doc.sa.Lookup([]byte(word), 1) == nil {
-				continue candidateLoop // false positive
-			}
-		}
-		docIDs = append(docIDs, doc.id)
+		tGrams = trigram.Extract(suffixForm(strings.TrimPrefix(word, `_`)), tGrams)
 	}
+	return tGrams
+}
+
+// extract appends the trigrams indexed for an anchored word or secondary form to tGrams
+func (svc *Service) extract(word string, tGrams []trigram.T) []trigram.T {
+	return svc.withSuffixes(trigram.Extract(word, tGrams), []string{word})
+}
+
+// unindex removes the postings added for an anchored word or secondary form from the
+// trigram index
+func (svc *Service) unindex(word string, docID trigram.DocID) {
+	svc.idx.Delete(word, docID)
+	if svc.suffixes && !isSecondary(word) {
+		svc.idx.Delete(suffixForm(strings.TrimPrefix(word, `_`)), docID)
+	}
+}
+
+// Search performs a fulltext search suitable for a typeahead search box.
+// The returned docIDs are the external IDs provided at time of indexing.
+// Whitespace around and between query words is ignored, and a query without any
+// words, such as an empty or all-whitespace query, is an error.
+func (svc *Service) Search(ctx context.Context, query string) (docIDs []uint64, err error) {
+	docIDs, _, err = svc.SearchWith(ctx, query, SearchOptions{})
 	return
 }
 
 // Upsert adds or updates a document in the full text index
 func (svc *Service) Upsert(ctx context.Context, docs []Doc) (err error) {
-	// validate inputs
-	for i, doc := range docs {
-		if doc.ID == 0 {
-			return fmt.Errorf(`docs[%d]: ID must be greater than zero`, i)
-		}
-		if _, ok := svc.extIDs[doc.ID]; ok {
-			if len(doc.PriorText) == 0 {
-				return fmt.Errorf(`docs[%d] is already indexed, but the OldText parameter was not provided.  To update the document, the text it contained previously must also be provided`, i)
-			}
-		}
-	}
-	// update the index
-	var b strings.Builder
+	p := svc.startProgress()
+	defer p.stop() // after the lock is released
 	svc.Lock()
 	defer svc.Unlock()
+	if err = svc.validate(docs); err != nil {
+		return err
+	}
+	svc.upsert(docs, p)
+	return nil
+}
+
+// upsert implements Upsert for validated docs, counting each document indexed with p,
+// which may be nil.  The caller must hold the write lock.
+func (svc *Service) upsert(docs []Doc, p *progress) {
+	svc.add(docs, p)
+	svc.idx.Prune(0.1)
+	svc.idx.Sort()
+	svc.compactIfNeeded()
+}
+
+// add indexes validated docs without pruning or sorting the trigram index.  The caller
+// must hold the write lock.
+func (svc *Service) add(docs []Doc, p *progress) {
+	if svc.canonical {
+		docs = slices.Clone(docs)
+		sort.SliceStable(docs, func(i, j int) bool { return docs[i].ID < docs[j].ID })
+	}
+	var b strings.Builder
+	now := svc.now()
+	buf := tGramPool.Get().(*[]trigram.T)
+	defer tGramPool.Put(buf)
 	for _, doc := range docs {
 		b.Reset()
+		doc.Text, doc.PriorText = svc.limit(doc.Text), svc.limit(doc.PriorText)
+		tGrams, words, spans := svc.analyzeSpans(doc.Text, (*buf)[:0])
+		*buf = tGrams // keep any growth for the next document
 		if docID, ok := svc.extIDs[doc.ID]; ok {
+			if !svc.changed(docID, words) {
+				// the document would be reindexed exactly as it is, so leave the trigram
+				// index alone rather than deleting and re-adding the same postings
+				m := svc.docs[docID]
+				m.updatedAt, m.text, m.spans = now, doc.Text, spans
+				svc.docs[docID] = m
+				svc.emit(Change{Op: OpUpsert, ID: doc.ID, Text: doc.Text})
+				p.advance()
+				continue
+			}
 			// this is an update, so first remove the old document from the trigram index
-			_, words := analyze(doc.PriorText)
-			for _, word := range words {
-				svc.idx.Delete(word, docID)
+			_, words := svc.analyze(doc.PriorText, nil)
+			for _, word := range append(words, svc.secondaryForms(words)...) {
+				svc.unindex(word, docID)
 			}
 			// now remove the metadata associated with the old internal ID
+			svc.forget(svc.docs[docID])
 			delete(svc.docs, docID)
+			svc.mutations++
 		}
-		tGrams, words := analyze(doc.Text)
 		for _, word := range words {
 			b.WriteString(saDelim)
 			b.WriteString(word)
 		}
+		for _, form := range svc.secondaryForms(words) {
+			b.WriteString(saDelim)
+			b.WriteString(form)
+			tGrams = trigram.Extract(form, tGrams)
+		}
 		b.WriteString(saDelim)
+		svc.reserveInternalID()
 		docID := svc.idx.AddTrigrams(tGrams)
-		svc.docs[docID] = meta{
-			id: doc.ID,
-			sa: suffixarray.New([]byte(b.String())),
+		m := meta{
+			id:        doc.ID,
+			sa:        svc.newSuffixArray([]byte(b.String())),
+			updatedAt: now,
+			text:      doc.Text,
+			spans:     spans,
 		}
+		if svc.dedupThreshold > 0 {
+			m.sig = fingerprint(trigramSet(words))
+		}
+		svc.docs[docID] = m
 		svc.extIDs[doc.ID] = docID
+		svc.emit(Change{Op: OpUpsert, ID: doc.ID, Text: doc.Text})
+		p.advance()
 	}
-	svc.idx.Prune(0.1)
-	svc.idx.Sort()
+}
+
+// validate checks that docs may be upserted.  The caller must hold the lock.
+func (svc *Service) validate(docs []Doc) error {
+	for i, doc := range docs {
+		if doc.ID == 0 {
+			return fmt.Errorf(`docs[%d]: ID must be greater than zero`, i)
+		}
+		if err := svc.checkLength(doc.Text); err != nil {
+			return fmt.Errorf(`docs[%d]: %w`, i, err)
+		}
+		if _, ok := svc.extIDs[doc.ID]; ok {
+			if len(doc.PriorText) == 0 {
+				return fmt.Errorf(`docs[%d] is already indexed, but the OldText parameter was not provided.  To update the document, the text it contained previously must also be provided`, i)
+			}
+		}
+	}
+	return svc.checkDuplicates(docs)
+}
+
+// changed reports whether words differ from the words indexed for the document with
+// the given internal ID.  The caller must hold the lock.
+func (svc *Service) changed(docID trigram.DocID, words []string) bool {
+	return !slices.Equal(svc.docs[docID].words(), words)
+}
+
+// UpsertDryRun reports how Upsert would treat docs without modifying the index:
+// inserts counts documents that are not yet indexed, updates counts indexed documents
+// whose text would change and unchanged counts indexed documents whose text analyzes
+// to the same words as before.  docs are validated exactly as Upsert would validate them.
+func (svc *Service) UpsertDryRun(ctx context.Context, docs []Doc) (inserts, updates, unchanged int, err error) {
+	svc.RLock()
+	defer svc.RUnlock()
+	if err = svc.validate(docs); err != nil {
+		return 0, 0, 0, err
+	}
+	for _, doc := range docs {
+		select {
+		case <-ctx.Done():
+			return 0, 0, 0, ctx.Err()
+		default:
+		}
+		docID, ok := svc.extIDs[doc.ID]
+		if !ok {
+			inserts++
+			continue
+		}
+		if _, words := svc.analyze(svc.limit(doc.Text), nil); svc.changed(docID, words) {
+			updates++
+		} else {
+			unchanged++
+		}
+	}
+	return
+}
+
+// Delete removes a document from the full text index
+func (svc *Service) Delete(ctx context.Context, id uint64) error {
+	svc.Lock()
+	defer svc.Unlock()
+	docID, ok := svc.extIDs[id]
+	if !ok {
+		return fmt.Errorf(`document %d is not indexed`, id)
+	}
+	svc.remove(docID)
+	svc.mutations++
+	svc.compactIfNeeded()
 	return nil
 }
+
+// DeleteWhere removes every document whose external ID satisfies pred and returns the
+// number of documents removed.  pred is called with the write lock held, so it must not
+// call back into the Service.  If ctx is cancelled part way through, the documents
+// removed so far stay removed and the count reflects them.  Compaction, if configured,
+// is considered once after all the deletions rather than after each one.
+func (svc *Service) DeleteWhere(ctx context.Context, pred func(id uint64) bool) (n int, err error) {
+	svc.Lock()
+	defer svc.Unlock()
+	defer svc.compactIfNeeded()
+	for id, docID := range svc.extIDs {
+		select {
+		case <-ctx.Done():
+			return n, ctx.Err()
+		default:
+		}
+		if pred(id) {
+			svc.remove(docID)
+			svc.mutations++
+			n++
+		}
+	}
+	return n, nil
+}
+
+// remove deletes the document with the given internal ID from the trigram index and
+// discards its metadata.  The caller must hold the write lock.
+func (svc *Service) remove(docID trigram.DocID) {
+	doc := svc.docs[docID]
+	for _, word := range doc.entries() {
+		svc.unindex(word, docID)
+	}
+	svc.forget(doc)
+	delete(svc.docs, docID)
+	delete(svc.extIDs, doc.id)
+	svc.emit(Change{Op: OpDelete, ID: doc.id})
+}
@@ -2,8 +2,14 @@ package fulltext
 
 import (
 	"context"
+	"fmt"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/dgryski/go-trigram"
 )
 
 var (
@@ -161,3 +167,451 @@ func TestService_Search(t *testing.T) {
 		})
 	}
 }
+
+func TestService_Search_allPruned(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	var docs []Doc
+	for id := uint64(1); id <= 20; id++ {
+		docs = append(docs, Doc{ID: id, Text: docThree.Text})
+	}
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	// updates retire internal IDs, which the fallback scan must skip
+	for i := 0; i < 3; i++ {
+		err := svc.Upsert(ctx, []Doc{{ID: 1, Text: docThree.Text, PriorText: docThree.Text}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tGrams, _ := svc.analyze("peppers", nil)
+	for _, tg := range tGrams {
+		if posting, ok := svc.idx.Posting(tg); !ok || posting != nil {
+			t.Fatalf("expected every trigram of 'peppers' to be pruned")
+		}
+	}
+	// the trigram index falls back to every internal ID ever assigned
+	all, _ := svc.idx.Posting(trigram.TAllDocIDs)
+	if got := svc.idx.QueryTrigrams(tGrams); !reflect.DeepEqual(got, all) {
+		t.Errorf("Index.QueryTrigrams() = %v, want every internal ID %v", got, all)
+	}
+	// retired IDs do not count towards the breadth of a query matching every document
+	svc.maxQueryBreadth = 1
+	if _, err := svc.Search(ctx, "peppers"); err != nil {
+		t.Errorf("Service.Search() error = %v with WithMaxQueryBreadth(1)", err)
+	}
+	got, err := svc.Search(ctx, "peppers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[uint64]bool)
+	for _, id := range got {
+		if seen[id] {
+			t.Errorf("Service.Search() returned %d more than once", id)
+		}
+		seen[id] = true
+	}
+	if len(seen) != len(docs) {
+		t.Errorf("Service.Search() = %v, want all %d documents", got, len(docs))
+	}
+}
+
+func TestService_ChangedSince(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := start
+	svc.now = func() time.Time { return clock }
+	if err := svc.Upsert(ctx, []Doc{docThree}); err != nil {
+		t.Fatal(err)
+	}
+	clock = start.Add(time.Hour)
+	if err := svc.Upsert(ctx, []Doc{docTwo}); err != nil {
+		t.Fatal(err)
+	}
+	clock = start.Add(2 * time.Hour)
+	if err := svc.Upsert(ctx, []Doc{docOne}); err != nil {
+		t.Fatal(err)
+	}
+	clock = start.Add(3 * time.Hour)
+	err := svc.Upsert(ctx, []Doc{{ID: docThree.ID, Text: "Peter Piper picked a peck of spicy peppers", PriorText: docThree.Text}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		since time.Time
+		want  []uint64
+	}{
+		{
+			name:  "everything, oldest first",
+			since: start,
+			want:  []uint64{docTwo.ID, docOne.ID, docThree.ID},
+		},
+		{
+			name:  "cutoff is inclusive",
+			since: start.Add(2 * time.Hour),
+			want:  []uint64{docOne.ID, docThree.ID},
+		},
+		{
+			name:  "updates count as changes",
+			since: start.Add(150 * time.Minute),
+			want:  []uint64{docThree.ID},
+		},
+		{
+			name:  "nothing changed",
+			since: start.Add(4 * time.Hour),
+			want:  []uint64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := svc.ChangedSince(tt.since); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.ChangedSince() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_Delete(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Delete(ctx, docThree.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Delete(ctx, docThree.ID); err == nil {
+		t.Error("Service.Delete() of a document that is not indexed should return an error")
+	}
+	got, err := svc.Search(ctx, "jump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{docOne.ID}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.Search() = %v, want %v", got, want)
+	}
+	// a deleted document may be indexed again without PriorText
+	if err := svc.Upsert(ctx, []Doc{docThree}); err != nil {
+		t.Fatal(err)
+	}
+	if svc.DocCount() != 3 {
+		t.Errorf("Service.DocCount() = %d, want %d", svc.DocCount(), 3)
+	}
+}
+
+func TestService_IDs(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docThree, docOne, docTwo}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Delete(ctx, docTwo.ID); err != nil {
+		t.Fatal(err)
+	}
+	want := []uint64{docOne.ID, docThree.ID}
+	if got := svc.IDs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.IDs() = %v, want %v", got, want)
+	}
+	var visited int
+	svc.Range(func(id uint64) bool {
+		visited++
+		return false
+	})
+	if visited != 1 {
+		t.Errorf("Service.Range() visited %d IDs after fn returned false, want %d", visited, 1)
+	}
+}
+
+func TestService_UpsertDryRun(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo}); err != nil {
+		t.Fatal(err)
+	}
+	batch := []Doc{
+		docThree, // new
+		{ID: docOne.ID, Text: "The quick brown fox naps", PriorText: docOne.Text},               // modified
+		{ID: docTwo.ID, Text: "she SELLS sea-shells by the sea shore!", PriorText: docTwo.Text}, // analyzes identically
+	}
+	inserts, updates, unchanged, err := svc.UpsertDryRun(ctx, batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserts != 1 || updates != 1 || unchanged != 1 {
+		t.Errorf("Service.UpsertDryRun() = (%d, %d, %d), want (1, 1, 1)", inserts, updates, unchanged)
+	}
+	// nothing was applied
+	if svc.DocCount() != 2 {
+		t.Errorf("Service.DocCount() = %d, want %d", svc.DocCount(), 2)
+	}
+	got, err := svc.Search(ctx, "naps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Service.Search() = %v, want no results", got)
+	}
+	// validation matches Upsert
+	if _, _, _, err := svc.UpsertDryRun(ctx, []Doc{{ID: docOne.ID, Text: "no prior text"}}); err == nil {
+		t.Error("Service.UpsertDryRun() should reject an update without PriorText")
+	}
+}
+
+func TestService_Tokens(t *testing.T) {
+	ctx := context.TODO()
+	text := "Peter Piper's PICKLED peppers -- 3.99/lb, naïve-café"
+	tests := []struct {
+		name      string
+		tokenizer Tokenizer
+	}{
+		{name: "default", tokenizer: DefaultTokenizer},
+		{name: "unicode", tokenizer: UnicodeTokenizer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewService(WithTokenizer(tt.tokenizer))
+			if err := svc.Upsert(ctx, []Doc{{ID: 1, Text: text}}); err != nil {
+				t.Fatal(err)
+			}
+			tokens, ok := svc.Tokens(1)
+			if !ok {
+				t.Fatal("Service.Tokens() did not find the document")
+			}
+			words, spans := tt.tokenizer.(SpanTokenizer).TokenizeSpans(text)
+			if len(tokens) != len(words) {
+				t.Fatalf("Service.Tokens() returned %d tokens, want %d", len(tokens), len(words))
+			}
+			for i, tok := range tokens {
+				if tok.Word != words[i] || tok.Span != spans[i] {
+					t.Errorf("Service.Tokens()[%d] = %+v, want %q at %+v", i, tok, words[i], spans[i])
+				}
+			}
+		})
+	}
+	svc := NewService(WithTokenizer(UnicodeTokenizer))
+	if err := svc.Upsert(ctx, []Doc{docThree}); err != nil {
+		t.Fatal(err)
+	}
+	tokens, _ := svc.Tokens(docThree.ID)
+	var original []string
+	for _, tok := range tokens {
+		original = append(original, docThree.Text[tok.Offset:tok.Offset+tok.Length])
+	}
+	if got := strings.Join(original, " "); got != docThree.Text {
+		t.Errorf("spans reconstruct %q, want %q", got, docThree.Text)
+	}
+	if _, ok := svc.Tokens(42); ok {
+		t.Error("Service.Tokens() found a document that was never indexed")
+	}
+}
+
+func TestService_Upsert_identical(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	before := svc.extIDs[docThree.ID]
+	for i := 0; i < 3; i++ {
+		err := svc.Upsert(ctx, []Doc{{ID: docThree.ID, Text: docThree.Text, PriorText: docThree.Text}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if after := svc.extIDs[docThree.ID]; after != before {
+		t.Errorf("identical re-upsert moved the document from internal ID %d to %d", before, after)
+	}
+	if svc.mutations != 0 {
+		t.Errorf("identical re-upserts counted as %d mutations, want 0", svc.mutations)
+	}
+	for _, query := range []string{"peter", "pickled peppers", "jump", "sea shells"} {
+		got, err := svc.Search(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Contains(got, docThree.ID) {
+			t.Errorf("Service.Search(%q) = %v, want it to include %d", query, got, docThree.ID)
+		}
+	}
+	// text that analyzes identically still replaces the stored text
+	shouted := strings.ToUpper(docThree.Text)
+	if err := svc.Upsert(ctx, []Doc{{ID: docThree.ID, Text: shouted, PriorText: docThree.Text}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := svc.docs[before].text; got != shouted {
+		t.Errorf("stored text = %q, want %q", got, shouted)
+	}
+}
+
+func TestService_InternalID(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	update := Doc{ID: docTwo.ID, Text: "She sells shells", PriorText: docTwo.Text}
+	if err := svc.Upsert(ctx, []Doc{update}); err != nil {
+		t.Fatal(err)
+	}
+	for _, doc := range []Doc{docOne, update, docThree} {
+		docID, ok := svc.InternalID(doc.ID)
+		if !ok {
+			t.Fatalf("Service.InternalID(%d) not found", doc.ID)
+		}
+		if got := svc.docs[docID].id; got != doc.ID {
+			t.Errorf("Service.InternalID(%d) = %d, which holds document %d", doc.ID, docID, got)
+		}
+		// the internal ID is what candidate generation produces for the document's own words
+		tGrams, _ := svc.analyze(doc.Text, nil)
+		if !slices.Contains(svc.idx.QueryTrigrams(tGrams), docID) {
+			t.Errorf("internal ID %d is not a candidate for the text of document %d", docID, doc.ID)
+		}
+	}
+	if docID, _ := svc.InternalID(docTwo.ID); docID != 3 {
+		t.Errorf("Service.InternalID() of an updated document = %d, want a new internal ID %d", docID, 3)
+	}
+	if _, ok := svc.InternalID(42); ok {
+		t.Error("Service.InternalID() found a document that was never indexed")
+	}
+}
+
+func TestService_DeleteWhere(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	var docs []Doc
+	for id := uint64(1); id <= 10; id++ {
+		docs = append(docs, Doc{ID: id, Text: fmt.Sprintf("pickled peppers batch %d", id)})
+	}
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	n, err := svc.DeleteWhere(ctx, func(id uint64) bool { return id%2 == 0 })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("Service.DeleteWhere() removed %d documents, want %d", n, 5)
+	}
+	if want := []uint64{1, 3, 5, 7, 9}; !reflect.DeepEqual(svc.IDs(), want) {
+		t.Errorf("Service.IDs() = %v, want %v", svc.IDs(), want)
+	}
+	got, err := svc.Search(ctx, "pickled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{1, 3, 5, 7, 9}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.Search() = %v, want %v", got, want)
+	}
+	if err := svc.Validate(); err != nil {
+		t.Error(err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := svc.DeleteWhere(cancelled, func(uint64) bool { return true }); err == nil {
+		t.Error("Service.DeleteWhere() with a cancelled context should return an error")
+	}
+}
+
+func TestService_Search_sentinels(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService(WithTokenizer(TokenizerFunc(strings.Fields)))
+	docs := []Doc{
+		{ID: 1, Text: "call parse_int here"},
+		{ID: 2, Text: "int main"},
+		{ID: 3, Text: "raw nul\x00byte data"},
+		{ID: 4, Text: "_private field"},
+	}
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		query  string
+		anchor Anchor
+		want   []uint64
+	}{
+		{
+			name:  "an underscore inside a word is not a word boundary",
+			query: "int",
+			want:  []uint64{2},
+		},
+		{
+			name:  "a word with an underscore matches by prefix",
+			query: "parse_i",
+			want:  []uint64{1},
+		},
+		{
+			name:  "a leading underscore is part of the word",
+			query: "_priv",
+			want:  []uint64{4},
+		},
+		{
+			name:  "a leading underscore must be typed",
+			query: "priv",
+			want:  []uint64{},
+		},
+		{
+			name:   "an underscore is found inside words",
+			query:  "e_i",
+			anchor: AnchorContains,
+			want:   []uint64{1},
+		},
+		{
+			name:  "a NUL byte inside a word is not a word boundary",
+			query: "byte",
+			want:  []uint64{},
+		},
+		{
+			name:   "a word containing a NUL byte matches whole",
+			query:  "nul\x00byte",
+			anchor: AnchorWhole,
+			want:   []uint64{3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := svc.SearchWith(ctx, tt.query, SearchOptions{Anchor: tt.anchor})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.SearchWith(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+	tokens, _ := svc.Tokens(3)
+	if got := tokens[1].Word; got != "nul\x00byte" {
+		t.Errorf("Service.Tokens() word = %q, want %q", got, "nul\x00byte")
+	}
+	if err := svc.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func BenchmarkService_Upsert_expectedDocs(b *testing.B) {
+	const n = 200000
+	docs := make([]Doc, n)
+	for i := range docs {
+		docs[i] = Doc{ID: uint64(i + 1), Text: fmt.Sprintf("document %d", i)}
+	}
+	benchmarks := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "unsized"},
+		{name: "sized", opts: []Option{WithExpectedDocs(n)}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				svc := NewService(bm.opts...)
+				if err := svc.Upsert(context.TODO(), docs); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package fulltext
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// KeyedDoc is a document to be indexed by a KeyedService
+type KeyedDoc struct {
+	Key       string // external key, such as a composite "tenant/item" key; must be unique
+	Text      string // the text to index
+	PriorText string // the text that was previously indexed.  This is required for updates only - leave empty for new documents
+}
+
+// KeyedService indexes documents under string keys rather than uint64 IDs, for callers
+// whose documents are identified by composite or non-numeric keys that do not fit in a
+// uint64.  It wraps a Service, assigning each new key the next unused uint64 ID and
+// translating between the two, so it behaves exactly like a Service whose IDs happen
+// to be strings.  IDs are never reused, so a key deleted and later upserted again is
+// assigned a new ID.  The mapping costs about two map entries per key on top of the
+// Service itself.  Service remains the way to index documents with uint64 IDs.
+type KeyedService struct {
+	svc  *Service
+	mu   sync.RWMutex      // protects ids, keys and next; held across writes to svc
+	ids  map[string]uint64 // the ID assigned to each indexed key
+	keys map[uint64]string // the key each assigned ID stands for
+	next uint64            // the most recently assigned ID
+}
+
+// NewKeyedService initializes a KeyedService whose underlying Service is configured
+// with opts
+func NewKeyedService(opts ...Option) *KeyedService {
+	return &KeyedService{
+		svc:  NewService(opts...),
+		ids:  make(map[string]uint64),
+		keys: make(map[uint64]string),
+	}
+}
+
+// DocCount returns the number of documents in the index
+func (k *KeyedService) DocCount() int {
+	return k.svc.DocCount()
+}
+
+// Upsert adds or updates documents in the full text index.  Documents whose key is not
+// indexed yet are assigned IDs, which are released again if the Service rejects the
+// batch.
+func (k *KeyedService) Upsert(ctx context.Context, docs []KeyedDoc) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	batch := make([]Doc, len(docs))
+	var assigned []string
+	for i, doc := range docs {
+		id, ok := k.ids[doc.Key]
+		if !ok {
+			k.next++
+			id = k.next
+			k.ids[doc.Key], k.keys[id] = id, doc.Key
+			assigned = append(assigned, doc.Key)
+		}
+		batch[i] = Doc{ID: id, Text: doc.Text, PriorText: doc.PriorText}
+	}
+	if err := k.svc.Upsert(ctx, batch); err != nil {
+		for _, key := range assigned {
+			delete(k.keys, k.ids[key])
+			delete(k.ids, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes a document from the full text index
+func (k *KeyedService) Delete(ctx context.Context, key string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	id, ok := k.ids[key]
+	if !ok {
+		return fmt.Errorf(`document '%s' is not indexed`, key)
+	}
+	if err := k.svc.Delete(ctx, id); err != nil {
+		return err
+	}
+	delete(k.ids, key)
+	delete(k.keys, id)
+	return nil
+}
+
+// Search performs a fulltext search, as Service.Search does, returning the keys of the
+// matching documents
+func (k *KeyedService) Search(ctx context.Context, query string) ([]string, error) {
+	keys, _, err := k.SearchWith(ctx, query, SearchOptions{})
+	return keys, err
+}
+
+// SearchWith performs a fulltext search using the supplied options, as
+// Service.SearchWith does, returning the keys of the matching documents
+func (k *KeyedService) SearchWith(ctx context.Context, query string, opts SearchOptions) (keys []string, partial bool, err error) {
+	ids, partial, err := k.svc.SearchWith(ctx, query, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	keys = make([]string, 0, len(ids))
+	for _, id := range ids {
+		// a document deleted since the search ran has no key any more
+		if key, ok := k.keys[id]; ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, partial, nil
+}
+
+// Key returns the key of the document indexed under id, for translating the results of
+// methods of the underlying Service, which report IDs.  ok is false if no document is
+// indexed under id.
+func (k *KeyedService) Key(id uint64) (key string, ok bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok = k.keys[id]
+	return
+}
+
+// Close stops the background compaction of the underlying Service, as Service.Close does
+func (k *KeyedService) Close() error {
+	return k.svc.Close()
+}
+
+// Service returns the underlying Service, for methods KeyedService does not wrap.  The
+// Service identifies documents by the IDs assigned to their keys; use Key to translate
+// them.  Documents must only be added, updated or deleted through the KeyedService.
+func (k *KeyedService) Service() *Service {
+	return k.svc
+}
@@ -0,0 +1,76 @@
+package fulltext
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestKeyedService(t *testing.T) {
+	ctx := context.TODO()
+	k := NewKeyedService()
+	docs := []KeyedDoc{
+		{Key: "tenantA/item42", Text: docOne.Text},
+		{Key: "tenantA/item7", Text: docTwo.Text},
+		{Key: "tenantB/item42", Text: docThree.Text},
+	}
+	if err := k.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "fox", want: []string{"tenantA/item42"}},
+		{query: "sea shells", want: []string{"tenantA/item7", "tenantB/item42"}},
+		{query: "zebra", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := k.Search(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("KeyedService.Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	// updates keep the key's ID
+	update := KeyedDoc{Key: "tenantA/item42", Text: "The quick brown fox naps", PriorText: docOne.Text}
+	if err := k.Upsert(ctx, []KeyedDoc{update}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := k.Search(ctx, "naps"); err != nil || !reflect.DeepEqual(got, []string{"tenantA/item42"}) {
+		t.Errorf("KeyedService.Search() = %v, %v after update", got, err)
+	}
+	if k.DocCount() != 3 {
+		t.Errorf("KeyedService.DocCount() = %d, want 3", k.DocCount())
+	}
+	// a rejected batch does not leave keys behind
+	if err := k.Upsert(ctx, []KeyedDoc{{Key: "tenantC/item1", Text: "new"}, {Key: "tenantA/item7", Text: "changed"}}); err == nil {
+		t.Fatal("KeyedService.Upsert() accepted an update without PriorText")
+	}
+	if _, ok := k.ids["tenantC/item1"]; ok {
+		t.Error("KeyedService.Upsert() kept the key of a rejected document")
+	}
+	if err := k.Delete(ctx, "tenantB/item42"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := k.Search(ctx, "sea shells"); err != nil || !reflect.DeepEqual(got, []string{"tenantA/item7"}) {
+		t.Errorf("KeyedService.Search() = %v, %v after delete", got, err)
+	}
+	if err := k.Delete(ctx, "tenantB/item42"); err == nil {
+		t.Error("KeyedService.Delete() of a deleted key should fail")
+	}
+	// results of the underlying Service translate back to keys
+	counts, err := k.Service().SearchCounts(ctx, "sea")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := range counts {
+		if key, ok := k.Key(id); !ok || key != "tenantA/item7" {
+			t.Errorf("KeyedService.Key(%d) = %q, %t, want %q, true", id, key, ok, "tenantA/item7")
+		}
+	}
+}
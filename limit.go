@@ -0,0 +1,45 @@
+package fulltext
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// LengthPolicy determines how Upsert handles a document longer than the maximum set
+// with WithMaxDocBytes
+type LengthPolicy int
+
+const (
+	// LengthReject fails the Upsert without modifying the index
+	LengthReject LengthPolicy = iota
+	// LengthTruncate indexes only the beginning of the document
+	LengthTruncate
+)
+
+// checkLength returns an error if text is too long to be indexed under a LengthReject policy
+func (svc *Service) checkLength(text string) error {
+	if svc.maxDocBytes > 0 && svc.lengthPolicy == LengthReject && len(text) > svc.maxDocBytes {
+		return fmt.Errorf(`text is %d bytes long, which exceeds the maximum of %d`, len(text), svc.maxDocBytes)
+	}
+	return nil
+}
+
+// limit returns text truncated under a LengthTruncate policy.  Rather than split a
+// word, text is cut at the last word boundary at or before the limit, where words are
+// runs of Unicode letters, numbers and marks as in UnicodeTokenizer.  A single word
+// longer than the limit leaves nothing to index.
+func (svc *Service) limit(text string) string {
+	if svc.maxDocBytes <= 0 || svc.lengthPolicy != LengthTruncate || len(text) <= svc.maxDocBytes {
+		return text
+	}
+	n := svc.maxDocBytes
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	if r, _ := utf8.DecodeRuneInString(text[n:]); !isUnicodeSeparator(r) {
+		// the limit falls within a word, so drop the partial word
+		return strings.TrimRightFunc(text[:n], func(r rune) bool { return !isUnicodeSeparator(r) })
+	}
+	return text[:n]
+}
@@ -0,0 +1,79 @@
+package fulltext
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestService_Upsert_maxDocBytes(t *testing.T) {
+	ctx := context.TODO()
+	oversized := Doc{ID: 1, Text: "Peter Piper picked a peck of pickled peppers"}
+	t.Run("LengthReject", func(t *testing.T) {
+		svc := NewService(WithMaxDocBytes(20, LengthReject))
+		err := svc.Upsert(ctx, []Doc{{ID: 2, Text: "short"}, oversized})
+		if err == nil || !strings.Contains(err.Error(), "exceeds the maximum of 20") {
+			t.Fatalf("Service.Upsert() error = %v, want a length error", err)
+		}
+		if got := svc.DocCount(); got != 0 {
+			t.Errorf("Service.DocCount() = %d, want %d after a rejected Upsert", got, 0)
+		}
+	})
+	t.Run("LengthTruncate", func(t *testing.T) {
+		// the limit falls within "picked", so the partial word is dropped
+		svc := NewService(WithMaxDocBytes(15, LengthTruncate))
+		if err := svc.Upsert(ctx, []Doc{oversized}); err != nil {
+			t.Fatal(err)
+		}
+		tests := []struct {
+			query string
+			want  []uint64
+		}{
+			{query: "piper", want: []uint64{1}},
+			{query: "pic", want: []uint64{}},
+			{query: "peppers", want: []uint64{}},
+		}
+		for _, tt := range tests {
+			got, err := svc.Search(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		}
+		// updating with the full prior text removes the truncated document's postings
+		update := Doc{ID: 1, Text: "Sally sells sea shells", PriorText: oversized.Text}
+		if err := svc.Upsert(ctx, []Doc{update}); err != nil {
+			t.Fatal(err)
+		}
+		if err := svc.Validate(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestService_limit(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		max  int
+		want string
+	}{
+		{name: "short text is untouched", text: "sea shells", max: 20, want: "sea shells"},
+		{name: "cut on a word boundary", text: "sea shells", max: 4, want: "sea "},
+		{name: "cut after a complete word", text: "sea shells", max: 3, want: "sea"},
+		{name: "cut within a word", text: "sea shells", max: 6, want: "sea "},
+		{name: "cut within a multibyte rune", text: "café au lait", max: 4, want: ""},
+		{name: "a single long word", text: "supercalifragilistic", max: 5, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewService(WithMaxDocBytes(tt.max, LengthTruncate))
+			if got := svc.limit(tt.text); got != tt.want {
+				t.Errorf("Service.limit(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package fulltext
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+	"time"
+
+	"github.com/dgryski/go-trigram"
+)
+
+// Reindex rebuilds the trigram index from the words stored for each live document.
+// Updates and deletes leave retired internal IDs (and, when PriorText was inaccurate,
+// stale postings) behind in the trigram index; rebuilding discards them.  Documents
+// keep their relative order but are assigned new internal IDs.  The index is write
+// locked for the duration of the rebuild.
+func (svc *Service) Reindex() {
+	svc.Lock()
+	defer svc.Unlock()
+	svc.reindex()
+}
+
+// reindex implements Reindex.  The caller must hold the write lock.
+func (svc *Service) reindex() {
+	svc.rebuilding.Add(1)
+	defer svc.rebuilding.Add(-1)
+	svc.docs, svc.extIDs, svc.idx = svc.rebuild(svc.docs)
+	svc.mutations = 0
+	svc.epoch++
+}
+
+// rebuild returns a new trigram index of docs, in which the documents keep their
+// relative order (or are put in canonical order) but are assigned new internal IDs,
+// along with the documents and the external ID mapping under their new internal IDs.
+// docs is only read, so the caller need not hold any lock if docs is a private copy.
+func (svc *Service) rebuild(docs map[trigram.DocID]meta) (map[trigram.DocID]meta, map[uint64]trigram.DocID, Index) {
+	docIDs := svc.docOrder(docs)
+	idx := svc.newIndex()
+	rebuilt := make(map[trigram.DocID]meta, len(docs))
+	extIDs := make(map[uint64]trigram.DocID, len(docs))
+	var tGrams []trigram.T
+	for _, oldID := range docIDs {
+		doc := docs[oldID]
+		tGrams = tGrams[:0]
+		for _, word := range doc.entries() {
+			tGrams = svc.extract(word, tGrams)
+		}
+		docID := idx.AddTrigrams(tGrams)
+		rebuilt[docID] = doc
+		extIDs[doc.id] = docID
+	}
+	idx.Prune(0.1)
+	idx.Sort()
+	return rebuilt, extIDs, idx
+}
+
+// docOrder returns the internal IDs of docs in insertion order, or in ascending order of
+// external ID when the Service uses WithCanonicalOrder
+func (svc *Service) docOrder(docs map[trigram.DocID]meta) []trigram.DocID {
+	docIDs := make([]trigram.DocID, 0, len(docs))
+	for docID := range docs {
+		docIDs = append(docIDs, docID)
+	}
+	if svc.canonical {
+		sort.Slice(docIDs, func(i, j int) bool { return docs[docIDs[i]].id < docs[docIDs[j]].id })
+	} else {
+		sort.Slice(docIDs, func(i, j int) bool { return docIDs[i] < docIDs[j] })
+	}
+	return docIDs
+}
+
+// compactEvery runs until Close, compacting the index in the background whenever it
+// has been updated or deleted from since the last compaction
+func (svc *Service) compactEvery(interval time.Duration) {
+	defer close(svc.compacted)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-svc.closing:
+			return
+		case <-ticker.C:
+			svc.compactInBackground()
+		}
+	}
+}
+
+// compactInBackground rebuilds the trigram index from a copy of the documents without
+// holding any lock, then installs it under the write lock unless the documents changed
+// in the meantime, in which case the rebuild is discarded and tried again next time
+func (svc *Service) compactInBackground() {
+	svc.RLock()
+	if svc.mutations == 0 {
+		svc.RUnlock()
+		return
+	}
+	generation := svc.generation
+	snapshot := maps.Clone(svc.docs)
+	svc.RUnlock()
+	docs, extIDs, idx := svc.rebuild(snapshot)
+	svc.Lock()
+	defer svc.Unlock()
+	if svc.generation != generation {
+		return
+	}
+	svc.docs, svc.extIDs, svc.idx = docs, extIDs, idx
+	svc.mutations = 0
+	svc.epoch++
+}
+
+// Close stops the background compaction started by WithCompactInterval, waiting for a
+// compaction in progress to finish.  The Service remains usable, but no longer compacts
+// in the background.  Close is safe to call more than once, and does nothing for a
+// Service without background compaction.  It always returns nil.
+func (svc *Service) Close() error {
+	svc.closeOnce.Do(func() {
+		if svc.closing != nil {
+			close(svc.closing)
+			<-svc.compacted
+		}
+	})
+	return nil
+}
+
+// RemoveStaleTrigrams deletes postings that refer to internal IDs no longer holding a
+// document, returning the number removed.  Such postings are left behind by updates
+// whose PriorText did not match the text previously indexed, and make those documents'
+// old words produce candidates that verification must reject.  Unlike Reindex, live
+// documents keep their internal IDs and the trigram index is not rebuilt, so the cost
+// is a walk of every posting list, and retired IDs remain registered with the trigram
+// index.  Trigrams pruned as too common are not affected.  An error is returned if the
+// trigram index fails to remove a posting, as a custom Index might.  The index is write
+// locked while postings are removed.
+func (svc *Service) RemoveStaleTrigrams() (removed int, err error) {
+	svc.Lock()
+	defer svc.Unlock()
+	type posting struct {
+		t     trigram.T
+		docID trigram.DocID
+	}
+	var stale []posting
+	svc.idx.Range(func(t trigram.T, docIDs []trigram.DocID) {
+		if t == trigram.TAllDocIDs {
+			return // the trigram library never removes IDs from the list of all documents
+		}
+		for _, docID := range docIDs {
+			if _, ok := svc.docs[docID]; !ok {
+				stale = append(stale, posting{t, docID})
+			}
+		}
+	})
+	for _, p := range stale {
+		// the trigram's own three bytes extract to just that trigram
+		svc.idx.Delete(trigramString(p.t), p.docID)
+		docIDs, _ := svc.idx.Posting(p.t)
+		if i := sort.Search(len(docIDs), func(i int) bool { return docIDs[i] >= p.docID }); i < len(docIDs) && docIDs[i] == p.docID {
+			return removed, fmt.Errorf(`trigram %q still has a posting for internal ID %d after removal`, trigramString(p.t), p.docID)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// maxInternalIDs is the number of distinct internal IDs a trigram index can assign,
+// since trigram.DocID has 32 bits.  It is a variable so that tests can lower it.
+var maxInternalIDs uint64 = 1 << 32
+
+// reserveInternalID reindexes when assigning another internal ID would overflow
+// trigram.DocID, which would otherwise wrap around and give the new document the ID of
+// an existing one.  The caller must hold the write lock.
+//
+// Internal IDs are never reused in place: the trigram index assigns them sequentially,
+// posting lists must stay sorted, and result order, SearchPage cursors and background
+// compaction all rely on a document's internal ID only ever increasing.  Updates and
+// deletes therefore retire IDs, which stay registered with the trigram index until a
+// compaction (Reindex, WithCompactThreshold or WithCompactInterval) assigns the live
+// documents fresh, dense IDs.  Without compaction the IDs grow with every update, and
+// this is the compaction of last resort.
+func (svc *Service) reserveInternalID() {
+	if all, _ := svc.idx.Posting(trigram.TAllDocIDs); uint64(len(all)) >= maxInternalIDs {
+		svc.reindex()
+	}
+}
+
+// compactIfNeeded reindexes once the number of updates and deletes since the last
+// compaction reaches the configured threshold.  The caller must hold the write lock.
+func (svc *Service) compactIfNeeded() {
+	if svc.compactThreshold > 0 && svc.mutations >= svc.compactThreshold {
+		svc.reindex()
+	}
+}
+
+// Validate checks that the index is internally consistent, returning a descriptive
+// error for the first violation found: every external ID must refer to a document,
+// every document must be reachable by its external ID and registered with the
+// trigram index, every trigram of a document's words must list the document (unless
+// pruned), and no posting may refer to a document that is no longer indexed.
+// Stale postings are usually left behind by updates whose PriorText did not match
+// the text previously indexed; Reindex removes them.
+func (svc *Service) Validate() error {
+	svc.RLock()
+	defer svc.RUnlock()
+	for id, docID := range svc.extIDs {
+		doc, ok := svc.docs[docID]
+		if !ok {
+			return fmt.Errorf(`document %d refers to missing internal ID %d`, id, docID)
+		}
+		if doc.id != id {
+			return fmt.Errorf(`document %d refers to internal ID %d, which belongs to document %d`, id, docID, doc.id)
+		}
+	}
+	registered := make(map[trigram.DocID]bool, len(svc.docs))
+	all, _ := svc.idx.Posting(trigram.TAllDocIDs)
+	for _, docID := range all {
+		registered[docID] = true
+	}
+	var tGrams []trigram.T
+	for docID, doc := range svc.docs {
+		if extID, ok := svc.extIDs[doc.id]; !ok || extID != docID {
+			return fmt.Errorf(`internal ID %d holds document %d, which is not mapped back to it`, docID, doc.id)
+		}
+		if !registered[docID] {
+			return fmt.Errorf(`internal ID %d (document %d) is missing from the trigram index`, docID, doc.id)
+		}
+		tGrams = tGrams[:0]
+		for _, word := range doc.entries() {
+			tGrams = svc.extract(word, tGrams)
+		}
+		for _, t := range tGrams {
+			posting, ok := svc.idx.Posting(t)
+			if ok && posting == nil {
+				continue // pruned
+			}
+			i := sort.Search(len(posting), func(i int) bool { return posting[i] >= docID })
+			if i == len(posting) || posting[i] != docID {
+				return fmt.Errorf(`trigram %q is missing a posting for internal ID %d (document %d)`, t, docID, doc.id)
+			}
+		}
+	}
+	var stale error
+	svc.idx.Range(func(t trigram.T, posting []trigram.DocID) {
+		if t == trigram.TAllDocIDs {
+			return // the trigram library never removes IDs from the list of all documents
+		}
+		if stale != nil {
+			return
+		}
+		for _, docID := range posting {
+			if _, ok := svc.docs[docID]; !ok {
+				stale = fmt.Errorf(`trigram %q has a stale posting for internal ID %d`, t, docID)
+				return
+			}
+		}
+	})
+	return stale
+}
@@ -0,0 +1,331 @@
+package fulltext
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgryski/go-trigram"
+)
+
+func TestService_Reindex(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	// an inaccurate PriorText leaves stale postings for "pickled" behind
+	spicy := Doc{ID: docThree.ID, Text: "Peter Piper picked a peck of spicy peppers", PriorText: "Peter Piper"}
+	if err := svc.Upsert(ctx, []Doc{spicy}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Delete(ctx, docOne.ID); err != nil {
+		t.Fatal(err)
+	}
+	svc.Reindex()
+	if got := len(allDocIDs(svc)); got != svc.DocCount() {
+		t.Errorf("trigram index has %d documents after Reindex, want %d", got, svc.DocCount())
+	}
+	for docID := range svc.docs {
+		if docID >= trigram.DocID(svc.DocCount()) {
+			t.Errorf("internal ID %d was not compacted", docID)
+		}
+	}
+	tests := []struct {
+		query string
+		want  []uint64
+	}{
+		{query: "spicy", want: []uint64{docThree.ID}},
+		{query: "pickled", want: []uint64{}},
+		{query: "fox", want: []uint64{}},
+		{query: "shells", want: []uint64{docTwo.ID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := svc.Search(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_compactThreshold(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService(WithCompactThreshold(5))
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	texts := []string{"The quick brown fox naps", docOne.Text}
+	update := func(i int) Doc {
+		return Doc{ID: docOne.ID, Text: texts[(i+1)%2], PriorText: texts[i%2]}
+	}
+	for i := 1; i < 5; i++ {
+		if err := svc.Upsert(ctx, []Doc{update(i)}); err != nil {
+			t.Fatal(err)
+		}
+		if svc.mutations != i {
+			t.Fatalf("after %d updates, mutations = %d", i, svc.mutations)
+		}
+	}
+	if got := len(allDocIDs(svc)); got != 3+4 {
+		t.Fatalf("trigram index has %d documents before compaction, want %d", got, 3+4)
+	}
+	if err := svc.Upsert(ctx, []Doc{update(5)}); err != nil {
+		t.Fatal(err)
+	}
+	if svc.mutations != 0 {
+		t.Errorf("mutations = %d after compaction, want 0", svc.mutations)
+	}
+	if got := len(allDocIDs(svc)); got != 3 {
+		t.Errorf("trigram index has %d documents after compaction, want %d", got, 3)
+	}
+	got, err := svc.Search(ctx, "fox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{docOne.ID}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.Search() = %v, want %v", got, want)
+	}
+}
+
+func TestService_compactInterval(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService(WithCompactInterval(time.Millisecond))
+	defer svc.Close()
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	texts := []string{"The quick brown fox naps", docOne.Text}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			update := Doc{ID: docOne.ID, Text: texts[(i+1)%2], PriorText: texts[i%2]}
+			if err := svc.Upsert(ctx, []Doc{update}); err != nil {
+				t.Error(err)
+				return
+			}
+			time.Sleep(100 * time.Microsecond)
+		}
+	}()
+	for i := 0; i < 500; i++ {
+		got, err := svc.Search(ctx, "sea shells")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []uint64{docTwo.ID, docThree.ID}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Service.Search() = %v during background compaction, want %v", got, want)
+		}
+		if got, err = svc.Search(ctx, "fox"); err != nil {
+			t.Fatal(err)
+		}
+		if want := []uint64{docOne.ID}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Service.Search() = %v during background compaction, want %v", got, want)
+		}
+	}
+	close(done)
+	wg.Wait()
+	// once updates stop, the next interval compacts the index
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		svc.RLock()
+		mutations := svc.mutations
+		svc.RUnlock()
+		if mutations == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("mutations = %d long after updates stopped, want 0", mutations)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := len(allDocIDs(svc)); got != 3 {
+		t.Errorf("trigram index has %d documents after compaction, want %d", got, 3)
+	}
+	if err := svc.Validate(); err != nil {
+		t.Errorf("Service.Validate() after compaction: %v", err)
+	}
+	if err := svc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Close(); err != nil {
+		t.Errorf("second Service.Close() = %v", err)
+	}
+}
+
+func TestService_Validate(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	var docs []Doc
+	for id := uint64(1); id <= 40; id++ {
+		docs = append(docs, Doc{ID: id, Text: fmt.Sprintf("document %d: %s", id, docThree.Text)})
+	}
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Validate(); err != nil {
+		t.Fatalf("Service.Validate() after initial load: %v", err)
+	}
+	for cycle := 0; cycle < 10; cycle++ {
+		for i := range docs {
+			if (i+cycle)%3 != 0 {
+				continue
+			}
+			next := Doc{ID: docs[i].ID, Text: fmt.Sprintf("cycle %d revision of document %d", cycle, docs[i].ID), PriorText: docs[i].Text}
+			if err := svc.Upsert(ctx, []Doc{next}); err != nil {
+				t.Fatal(err)
+			}
+			docs[i] = next
+		}
+		if _, err := svc.Search(ctx, fmt.Sprintf("cycle %d", cycle)); err != nil {
+			t.Fatal(err)
+		}
+		if err := svc.Delete(ctx, docs[cycle].ID); err == nil {
+			docs[cycle].PriorText = ""
+		}
+		if err := svc.Validate(); err != nil {
+			t.Fatalf("Service.Validate() after cycle %d: %v", cycle, err)
+		}
+	}
+	// an inaccurate PriorText leaves stale postings behind
+	wrong := Doc{ID: docs[20].ID, Text: "replacement", PriorText: "not what was indexed"}
+	if err := svc.Upsert(ctx, []Doc{wrong}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Validate(); err == nil {
+		t.Error("Service.Validate() did not detect stale postings")
+	}
+	svc.Reindex()
+	if err := svc.Validate(); err != nil {
+		t.Errorf("Service.Validate() after Reindex: %v", err)
+	}
+	// corrupt the ID mapping directly
+	svc.extIDs[999] = svc.extIDs[docs[30].ID]
+	if err := svc.Validate(); err == nil {
+		t.Error("Service.Validate() did not detect an external ID pointing at another document")
+	}
+}
+
+func TestService_RemoveStaleTrigrams(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	var docs []Doc
+	for id := uint64(1); id <= 40; id++ {
+		docs = append(docs, Doc{ID: id, Text: fmt.Sprintf("document%d zebra%d", id, id)})
+	}
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	// an inaccurate PriorText leaves the postings of "zebra7" behind
+	wrong := Doc{ID: 7, Text: "document7 replaced", PriorText: "document7"}
+	if err := svc.Upsert(ctx, []Doc{wrong}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Validate(); err == nil {
+		t.Fatal("Service.Validate() did not detect stale postings")
+	}
+	extIDs := maps.Clone(svc.extIDs)
+	removed, err := svc.RemoveStaleTrigrams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed == 0 {
+		t.Error("Service.RemoveStaleTrigrams() removed no postings")
+	}
+	if err := svc.Validate(); err != nil {
+		t.Errorf("Service.Validate() after RemoveStaleTrigrams: %v", err)
+	}
+	if !reflect.DeepEqual(svc.extIDs, extIDs) {
+		t.Error("Service.RemoveStaleTrigrams() changed internal IDs")
+	}
+	for query, want := range map[string][]uint64{"zebra7": {}, "zebra17": {17}, "replaced": {7}} {
+		got, err := svc.Search(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Service.Search(%q) = %v, want %v", query, got, want)
+		}
+	}
+	if removed, err := svc.RemoveStaleTrigrams(); err != nil || removed != 0 {
+		t.Errorf("second Service.RemoveStaleTrigrams() = %d, %v, want 0, nil", removed, err)
+	}
+}
+
+func TestService_internalIDsBounded(t *testing.T) {
+	defer func(max uint64) { maxInternalIDs = max }(maxInternalIDs)
+	maxInternalIDs = 50
+	ctx := context.TODO()
+	svc := NewService()
+	docs := make([]Doc, 10)
+	for i := range docs {
+		docs[i] = Doc{ID: uint64(i + 1), Text: fmt.Sprintf("document%d revision0", i+1)}
+	}
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	for cycle := 1; cycle <= 30; cycle++ {
+		for i := range docs {
+			next := Doc{ID: docs[i].ID, Text: fmt.Sprintf("document%d revision%d", docs[i].ID, cycle), PriorText: docs[i].Text}
+			if cycle%5 == 0 {
+				// deleting and reinserting retires internal IDs too
+				if err := svc.Delete(ctx, docs[i].ID); err != nil {
+					t.Fatal(err)
+				}
+				next.PriorText = ``
+			}
+			if err := svc.Upsert(ctx, []Doc{next}); err != nil {
+				t.Fatal(err)
+			}
+			docs[i] = next
+			if got := uint64(len(allDocIDs(svc))); got > maxInternalIDs {
+				t.Fatalf("cycle %d: trigram index has %d internal IDs, want at most %d", cycle, got, maxInternalIDs)
+			}
+		}
+	}
+	if err := svc.Validate(); err != nil {
+		t.Errorf("Service.Validate() after update cycles: %v", err)
+	}
+	for query, want := range map[string][]uint64{"document3": {3}, "revision30": {1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, "revision29": {}} {
+		got, err := svc.Search(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Service.Search(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestClose_wrappers(t *testing.T) {
+	sharded := NewShardedService(3, WithCompactInterval(time.Millisecond))
+	keyed := NewKeyedService(WithCompactInterval(time.Millisecond))
+	if err := sharded.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyed.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i, svc := range append(sharded.shards, keyed.svc) {
+		select {
+		case <-svc.compacted:
+		default:
+			t.Errorf("background compaction of Service %d still running after Close", i)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package fulltext
+
+import (
+	"fmt"
+
+	"github.com/dgryski/go-trigram"
+)
+
+// MergePolicy determines how Merge handles a document whose external ID
+// is already present in the destination index
+type MergePolicy int
+
+const (
+	// MergeError aborts the merge without modifying the index
+	MergeError MergePolicy = iota
+	// MergeOverwrite replaces the existing document with the merged one
+	MergeOverwrite
+)
+
+// Merge folds the documents of other into svc, so that Search finds documents
+// originally indexed by either Service.  Merged documents are assigned new internal
+// IDs, so the two indexes may have been built independently.  Collisions between
+// external IDs are resolved according to the MergePolicy of svc.  other is not modified
+// and may continue to be used.
+func (svc *Service) Merge(other *Service) error {
+	if other == svc {
+		return fmt.Errorf(`cannot merge an index into itself`)
+	}
+	swapMu.Lock()
+	defer swapMu.Unlock()
+	svc.Lock()
+	defer svc.Unlock()
+	other.RLock()
+	defer other.RUnlock()
+	if svc.unanchored != other.unanchored {
+		return fmt.Errorf(`cannot merge indexes that differ in WithSubstringMatching`)
+	}
+	if svc.mergePolicy == MergeError {
+		for id := range other.extIDs {
+			if _, ok := svc.extIDs[id]; ok {
+				return fmt.Errorf(`document %d is present in both indexes`, id)
+			}
+		}
+	}
+	// visit documents in insertion (or canonical) order so the merge is deterministic
+	docIDs := svc.docOrder(other.docs)
+	now := svc.now()
+	var tGrams []trigram.T
+	for _, otherID := range docIDs {
+		doc := other.docs[otherID]
+		doc.updatedAt = now // merged documents are changes to svc, whenever other indexed them
+		if docID, ok := svc.extIDs[doc.id]; ok {
+			svc.remove(docID)
+			svc.mutations++
+		}
+		tGrams = tGrams[:0]
+		for _, word := range doc.entries() {
+			tGrams = svc.extract(word, tGrams)
+		}
+		svc.reserveInternalID()
+		docID := svc.idx.AddTrigrams(tGrams)
+		if svc.saCache != nil || doc.sa.cache != nil || svc.maxSABytes > 0 || doc.sa.scan {
+			// resident suffix arrays are accounted for by the cache of the Service holding
+			// them, and whether a document is too large for one depends on that Service
+			doc.sa = svc.newSuffixArray(doc.sa.Bytes())
+		}
+		svc.docs[docID] = doc // otherwise the suffix array is never mutated, so it is safe to share
+		svc.extIDs[doc.id] = docID
+		svc.emit(Change{Op: OpUpsert, ID: doc.id, Text: doc.text})
+	}
+	svc.idx.Prune(0.1)
+	svc.idx.Sort()
+	svc.compactIfNeeded()
+	return nil
+}
@@ -0,0 +1,175 @@
+package fulltext
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestService_Merge(t *testing.T) {
+	ctx := context.TODO()
+	left := NewService()
+	if err := left.Upsert(ctx, []Doc{docOne, docTwo}); err != nil {
+		t.Fatal(err)
+	}
+	right := NewService()
+	if err := right.Upsert(ctx, []Doc{docThree}); err != nil {
+		t.Fatal(err)
+	}
+	if err := left.Merge(right); err != nil {
+		t.Fatal(err)
+	}
+	if left.DocCount() != 3 {
+		t.Errorf("Service.DocCount() = %d, want %d", left.DocCount(), 3)
+	}
+	tests := []struct {
+		query string
+		want  []uint64
+	}{
+		{query: "fox", want: []uint64{docOne.ID}},
+		{query: "pickled", want: []uint64{docThree.ID}},
+		{query: "jump", want: []uint64{docOne.ID, docThree.ID}},
+		{query: "sea shells", want: []uint64{docTwo.ID, docThree.ID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := left.Search(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_Merge_changedSince(t *testing.T) {
+	ctx := context.TODO()
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := start
+	left := NewService()
+	left.now = func() time.Time { return clock }
+	right := NewService()
+	right.now = func() time.Time { return start }
+	if err := left.Upsert(ctx, []Doc{docOne}); err != nil {
+		t.Fatal(err)
+	}
+	if err := right.Upsert(ctx, []Doc{docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	clock = start.Add(time.Hour)
+	if err := left.Merge(right); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := left.ChangedSince(clock), []uint64{docTwo.ID, docThree.ID}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.ChangedSince() = %v after Merge, want %v", got, want)
+	}
+}
+
+func TestService_Merge_collision(t *testing.T) {
+	ctx := context.TODO()
+	spicy := Doc{ID: docThree.ID, Text: "Peter Piper picked a peck of spicy peppers"}
+	tests := []struct {
+		name    string
+		policy  MergePolicy
+		query   string
+		want    []uint64
+		wantErr bool
+	}{
+		{
+			name:    "MergeError leaves the destination untouched",
+			policy:  MergeError,
+			query:   "pickled",
+			want:    []uint64{docThree.ID},
+			wantErr: true,
+		},
+		{
+			name:   "MergeOverwrite replaces the old text",
+			policy: MergeOverwrite,
+			query:  "pickled",
+			want:   []uint64{},
+		},
+		{
+			name:   "MergeOverwrite indexes the new text",
+			policy: MergeOverwrite,
+			query:  "spicy",
+			want:   []uint64{docThree.ID},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := NewService(WithMergePolicy(tt.policy))
+			if err := dst.Upsert(ctx, []Doc{docOne, docThree}); err != nil {
+				t.Fatal(err)
+			}
+			src := NewService()
+			if err := src.Upsert(ctx, []Doc{spicy}); err != nil {
+				t.Fatal(err)
+			}
+			err := dst.Merge(src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Service.Merge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got, err := dst.Search(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.Search() = %v, want %v", got, tt.want)
+			}
+			if dst.DocCount() != 2 {
+				t.Errorf("Service.DocCount() = %d, want %d", dst.DocCount(), 2)
+			}
+		})
+	}
+}
+
+func TestService_Merge_concurrent(t *testing.T) {
+	ctx := context.TODO()
+	a := NewService(WithMergePolicy(MergeOverwrite))
+	if err := a.Upsert(ctx, []Doc{docOne, docTwo}); err != nil {
+		t.Fatal(err)
+	}
+	b := NewService(WithMergePolicy(MergeOverwrite))
+	if err := b.Upsert(ctx, []Doc{docThree}); err != nil {
+		t.Fatal(err)
+	}
+	// merging in both directions at once, alongside a Swap, must not deadlock
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, f := range []func() error{
+		func() error { return a.Merge(b) },
+		func() error { return b.Merge(a) },
+		func() error { return a.Swap(b) },
+	} {
+		wg.Add(1)
+		go func(f func() error) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				if err := f(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(f)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("concurrent Merge calls deadlocked")
+	}
+	for _, svc := range []*Service{a, b} {
+		if svc.DocCount() != 3 {
+			t.Errorf("Service.DocCount() = %d, want %d", svc.DocCount(), 3)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package fulltext
+
+import "time"
+
+// Option configures a Service at construction time
+type Option func(*Service)
+
+// WithMergePolicy sets how Merge resolves external IDs present in both indexes.
+// The default is MergeError.
+func WithMergePolicy(p MergePolicy) Option {
+	return func(svc *Service) {
+		svc.mergePolicy = p
+	}
+}
+
+// WithCompactThreshold makes the Service Reindex automatically once n documents
+// have been updated or deleted since the last compaction.  The Upsert, Delete or
+// Merge call that crosses the threshold pays for the rebuild, so expect a latency
+// spike proportional to the size of the index on that call.  Zero, the default,
+// never compacts automatically.
+func WithCompactThreshold(n int) Option {
+	return func(svc *Service) {
+		svc.compactThreshold = n
+	}
+}
+
+// WithCompactInterval makes the Service Reindex in a background goroutine every d when
+// documents have been updated or deleted since.  Call Close to stop it; zero disables it.
+func WithCompactInterval(d time.Duration) Option {
+	return func(svc *Service) {
+		svc.compactInterval = d
+	}
+}
+
+// WithCanonicalOrder assigns internal IDs in ascending order of external ID rather than
+// in the order documents were upserted, so that indexes holding the same documents are
+// identical however they were built.  Documents added by a single Upsert are indexed in
+// external ID order, Reindex and compaction renumber every document in external ID
+// order, and SaveDocs writes documents in external ID order, so its output depends only
+// on the documents indexed.  Documents added by separate Upserts are only put in
+// canonical order by the next Reindex or compaction.  The cost is that the order of
+// insertion is lost: results that would be returned in insertion order, such as those
+// of Search with OrderNone, come back in external ID order after a Reindex, and an
+// index loaded by LoadDocs is in external ID order.
+func WithCanonicalOrder() Option {
+	return func(svc *Service) {
+		svc.canonical = true
+	}
+}
+
+// WithInitialLoad makes the Service report that it is not Ready until its initial load
+// completes, either when UpsertReader first returns without error or when MarkReady is
+// called, so that a load balancer does not route searches to it while it is empty.
+func WithInitialLoad() Option {
+	return func(svc *Service) {
+		svc.initialLoad = true
+	}
+}
+
+// WithExpectedDocs sizes the Service's document maps for n documents up front, which
+// avoids repeatedly growing them while bulk loading a known number of documents.  It
+// is only a hint: the Service holds any number of documents either way, and sizing
+// for documents that never arrive wastes memory.
+func WithExpectedDocs(n int) Option {
+	return func(svc *Service) {
+		if n > 0 {
+			svc.expectedDocs = n
+		}
+	}
+}
+
+// WithTokenizer sets the Tokenizer used to split text into words.  The same
+// Tokenizer is used at index and query time.  The default is DefaultTokenizer.
+func WithTokenizer(t Tokenizer) Option {
+	return func(svc *Service) {
+		svc.tokenizer = t
+	}
+}
+
+// WithMaxSuffixArrays caps the number of document suffix arrays held in memory at n.
+// Suffix arrays are by far the largest part of the index, so capping them lets a
+// Service hold many more documents.  The least recently used suffix arrays are evicted
+// and rebuilt from the document's stored words when a query next needs to verify that
+// document, trading CPU for memory.  Zero, the default, keeps every suffix array resident.
+func WithMaxSuffixArrays(n int) Option {
+	return func(svc *Service) {
+		if n > 0 {
+			svc.saCache = newSACache(n)
+		}
+	}
+}
+
+// WithMaxSuffixArrayBytes skips building suffix arrays for documents whose analyzed
+// words take more than n bytes, which protects the process from the memory and time a
+// suffix array of an outsized document costs: about nine times its size while building,
+// and a build time linear in its size.  Such documents are still indexed by the trigram
+// index, so candidate generation works as usual, but verifying them scans their words
+// directly, which takes time linear in their size on every query that finds them a
+// candidate, rather than the logarithmic lookups of a suffix array.  Queries that
+// match many oversized documents therefore slow down in proportion to their total size.
+// Zero, the default, builds a suffix array for every document.
+func WithMaxSuffixArrayBytes(n int) Option {
+	return func(svc *Service) {
+		svc.maxSABytes = n
+	}
+}
+
+// WithSuffixIndex additionally indexes a reversed, trailing-anchored form of every word
+// so that queries using AnchorSuffix can match the end of words, as when searching for
+// part numbers or filenames by their ending.  The extra trigrams roughly double the
+// size of the trigram index and the work done by Upsert; suffix arrays are unaffected.
+// Documents indexed before a Service is reconfigured are not re-analyzed, so enable the
+// option before loading documents.
+func WithSuffixIndex() Option {
+	return func(svc *Service) {
+		svc.suffixes = true
+	}
+}
+
+// WithIndex sets the function that creates the empty trigram Index a Service uses to
+// generate candidates, allowing backends other than the default, NewTrigramIndex, such
+// as one kept on disk.  newIndex is called once by NewService and again by every
+// Reindex, whose rebuilt index replaces the old one.
+func WithIndex(newIndex func() Index) Option {
+	return func(svc *Service) {
+		svc.newIndex = newIndex
+	}
+}
+
+// WithSubstringMatching indexes words without the leading anchor that ordinarily
+// restricts query words to matching the beginning of indexed words, so that every query
+// matches substrings anywhere within words: "row" matches "brown".  AnchorPrefix then
+// behaves like AnchorContains, while AnchorWhole and AnchorSuffix are unaffected.  The
+// trigram index is slightly smaller, since the trigrams spanning the anchor are no longer
+// indexed, but candidate generation is less selective for short query words.  The option
+// changes how documents are analyzed, so switching an existing index between modes
+// requires re-indexing every document into a new Service; Merge refuses to combine
+// Services that differ in this option.
+func WithSubstringMatching() Option {
+	return func(svc *Service) {
+		svc.unanchored = true
+	}
+}
+
+// WithMaxDocBytes limits the length of the text indexed for each document to n bytes.
+// Very long documents produce large suffix arrays and trigram sets that slow down
+// every query, so a limit protects a shared index from outliers.  Under LengthReject,
+// Upsert fails without modifying the index if any document is too long; under
+// LengthTruncate, only the beginning of the text is indexed, cut at the last word
+// boundary at or before n so that no partial word is indexed, and the truncated text is
+// what the Service stores.  Zero, the default, indexes documents of any length.
+func WithMaxDocBytes(n int, policy LengthPolicy) Option {
+	return func(svc *Service) {
+		svc.maxDocBytes, svc.lengthPolicy = n, policy
+	}
+}
+
+// WithChangeSink registers sink to receive a Change for each document upserted, merged
+// or deleted, in order, for replaying into a standby Service with Apply.  sink is called
+// with the write lock held and must not call back into the Service.
+func WithChangeSink(sink ChangeSink) Option {
+	return func(svc *Service) {
+		svc.changeSink = sink
+	}
+}
+
+// WithProgress registers fn to be called every n documents indexed by Upsert or
+// UpsertReader with the number of documents indexed so far by that call, so that
+// operators can follow a bulk load.  Counts start from zero for each call and include
+// documents whose text was unchanged.  fn is called from a separate goroutine, in
+// order, and never with the write lock held: it may call back into the Service, though
+// any method needing the lock waits until the Upsert releases it, and a batch indexed
+// under a single lock can therefore run ahead of its reports.  Every call to fn has
+// returned by the time Upsert or UpsertReader does.  Calls from concurrent Upserts may
+// interleave.  A batch rejected by validation reports nothing.
+func WithProgress(n int, fn func(done int)) Option {
+	return func(svc *Service) {
+		if n > 0 && fn != nil {
+			svc.progressEvery, svc.progressFn = n, fn
+		}
+	}
+}
+
+// WithMinQueryWordLength makes queries ignore words shorter than n runes as long as
+// the query has at least one longer word, so "a peck" is searched as "peck".  A short
+// prefix such as "p" matches a large share of the index, making the candidate set
+// expensive to verify while barely narrowing the results.  Unlike stop word filtering,
+// which removes particular words, this depends only on length, applies only at query
+// time (documents are indexed in full, so short words are still found when they are
+// all a query contains) and requires no reindexing to change.  Zero, the default,
+// uses every query word.
+func WithMinQueryWordLength(n int) Option {
+	return func(svc *Service) {
+		svc.minQueryWordLen = n
+	}
+}
+
+// WithMaxConcurrentSearches makes searches fail with ErrBusy while n are already
+// running.  Zero, the default, leaves the number of searches unbounded.
+func WithMaxConcurrentSearches(n int) Option {
+	return func(svc *Service) {
+		if n > 0 {
+			svc.searchSlots = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithMaxQueryBreadth makes Search and SearchWith fail with ErrQueryTooBroad when the
+// trigram index reports candidates for a query in more than fraction of the indexed
+// documents, before any are verified.  Candidates include trigram false positives, so
+// a query may be rejected even though fewer documents match.  Other search methods are
+// unaffected.  Zero, the default, disables the check; values of 1 or more never reject
+// a query.
+func WithMaxQueryBreadth(fraction float64) Option {
+	return func(svc *Service) {
+		svc.maxQueryBreadth = fraction
+	}
+}
+
+// WithRepeatFolding collapses runs of three or more of the same letter to keep letters
+// (1 or 2), at index and query time alike, so that "sooo goood" matches "so good".
+// A keep less than 1, the default, disables folding.
+func WithRepeatFolding(keep int) Option {
+	return func(svc *Service) {
+		svc.repeatKeep = min(keep, 2)
+	}
+}
+
+// WithNormalizer sets a function applied to text before it is tokenized, at index and
+// query time alike, such as strings.ToLowerSpecial for Turkish.  A transliterating
+// Tokenizer such as the default may undo it; use UnicodeTokenizer to keep "ı" distinct.
+func WithNormalizer(normalize func(text string) string) Option {
+	return func(svc *Service) {
+		svc.normalizer = normalize
+	}
+}
+
+// WithDedupThreshold makes Upsert and UpsertReader reject documents that are near
+// duplicates of a document indexed under another ID, or of another document in the
+// same batch, returning a *DuplicateError that identifies the existing document.  Two
+// documents are near duplicates when the Jaccard index of their trigram sets, estimated
+// from minhash fingerprints, is at least threshold; 1 rejects only documents with
+// identical trigram sets and 0.9 tolerates small edits.  Fingerprinting adds indexing
+// cost: each document is analyzed a second time, and its fingerprint is compared
+// against every document sharing one of its trigrams, which is every document when a
+// trigram has been pruned.  Merge and Apply do not check for duplicates.  Zero, the
+// default, disables deduplication.
+func WithDedupThreshold(threshold float64) Option {
+	return func(svc *Service) {
+		svc.dedupThreshold = threshold
+	}
+}
+
+// WithSecondaryAnalyzer indexes a secondary form of each word, derived by analyze, which
+// queries run with SearchOptions.Secondary may match instead of the word as typed.  Pass
+// Soundex to match names by sound.  An empty result means the word has no secondary form.
+func WithSecondaryAnalyzer(analyze func(word string) string) Option {
+	return func(svc *Service) {
+		svc.secondary = analyze
+	}
+}
+
+// WithSynonyms configures query expansion: a query word that is a key of synonyms is
+// satisfied by a document containing the word itself or any of the words it maps to,
+// which are matched with the same anchoring as the query word.  Expansion happens at
+// query time only, so the index does not grow and synonyms can be changed without
+// reindexing (by constructing a new Service).  Mappings are one-directional; list
+// both {"couch": {"sofa"}} and {"sofa": {"couch"}} for the words to be interchangeable.
+// Keys and synonyms are normalized by the Service's Tokenizer, and entries that do not
+// tokenize to exactly one word are ignored.
+func WithSynonyms(synonyms map[string][]string) Option {
+	return func(svc *Service) {
+		svc.synonyms = synonyms
+	}
+}
@@ -0,0 +1,87 @@
+package fulltext
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/dgryski/go-trigram"
+)
+
+// SearchPage performs the same search as Search, returning at most pageSize results
+// that follow cursor.  An empty cursor starts from the first result.  Pass the returned
+// nextCursor to fetch the following page; an empty nextCursor means there are no more
+// results.
+//
+// Pages are ordered by internal ID and the cursor records the internal ID of the last
+// result returned, so pagination is best-effort when the index changes between pages:
+// deleted documents are skipped, while documents inserted or updated after the cursor
+// was issued are assigned new internal IDs and therefore appear on a later page (an
+// updated document may be returned twice).  Compaction, whether by Reindex or
+// automatic, reassigns every internal ID, after which outstanding cursors fail with
+// ErrCursorExpired.
+func (svc *Service) SearchPage(ctx context.Context, query string, cursor string, pageSize int) (ids []uint64, nextCursor string, err error) {
+	if err := svc.acquireSearch(); err != nil {
+		return nil, ``, err
+	}
+	defer svc.releaseSearch()
+	if pageSize <= 0 {
+		return nil, ``, fmt.Errorf(`pageSize must be greater than zero`)
+	}
+	epoch, after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, ``, err
+	}
+	q, err := svc.newQuery(query, SearchOptions{})
+	if err != nil {
+		return nil, ``, err
+	}
+	defer q.release()
+	svc.RLock()
+	defer svc.RUnlock()
+	if len(cursor) > 0 && epoch != svc.epoch {
+		return nil, ``, ErrCursorExpired
+	}
+	candidates := svc.queryCandidates(q)
+	if len(cursor) > 0 {
+		start := sort.Search(len(candidates), func(i int) bool { return candidates[i] > after })
+		candidates = candidates[start:]
+	}
+	ids = make([]uint64, 0, pageSize)
+	var last trigram.DocID
+	err = svc.verify(ctx, candidates, q.matches, func(docID trigram.DocID, doc meta) bool {
+		if len(ids) == pageSize {
+			// there is at least one more result, so another page is needed
+			nextCursor = encodeCursor(svc.epoch, last)
+			return false
+		}
+		ids = append(ids, doc.id)
+		last = docID
+		return true
+	})
+	if err != nil {
+		return nil, ``, err
+	}
+	return ids, nextCursor, nil
+}
+
+// encodeCursor records the last internal ID returned and the epoch it belongs to
+func encodeCursor(epoch uint32, docID trigram.DocID) string {
+	var b [8]byte
+	binary.BigEndian.PutUint32(b[:4], epoch)
+	binary.BigEndian.PutUint32(b[4:], uint32(docID))
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
+
+func decodeCursor(cursor string) (uint32, trigram.DocID, error) {
+	if len(cursor) == 0 {
+		return 0, 0, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(b) != 8 {
+		return 0, 0, fmt.Errorf(`invalid cursor '%s'`, cursor)
+	}
+	return binary.BigEndian.Uint32(b[:4]), trigram.DocID(binary.BigEndian.Uint32(b[4:])), nil
+}
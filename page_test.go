@@ -0,0 +1,98 @@
+package fulltext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestService_SearchPage(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	var docs []Doc
+	for id := uint64(11); id <= 15; id++ {
+		docs = append(docs, Doc{ID: id, Text: fmt.Sprintf("pickled peppers batch %d", id)})
+	}
+	docs = append(docs, docOne)
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]uint64{{11, 12}, {13, 14}, {15}}
+	var cursor string
+	for page := 0; ; page++ {
+		ids, next, err := svc.SearchPage(ctx, "pickled", cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page >= len(want) {
+			t.Fatalf("Service.SearchPage() returned unexpected page %d: %v", page, ids)
+		}
+		if !reflect.DeepEqual(ids, want[page]) {
+			t.Errorf("Service.SearchPage() page %d = %v, want %v", page, ids, want[page])
+		}
+		if len(next) == 0 {
+			if page != len(want)-1 {
+				t.Errorf("Service.SearchPage() ended after page %d, want %d pages", page, len(want))
+			}
+			break
+		}
+		cursor = next
+	}
+}
+
+func TestService_SearchPage_exactPages(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	ids, next, err := svc.SearchPage(ctx, "jump", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{docOne.ID, docThree.ID}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("Service.SearchPage() = %v, want %v", ids, want)
+	}
+	if next != "" {
+		t.Errorf("Service.SearchPage() nextCursor = %q, want none when the last page is full", next)
+	}
+}
+
+func TestService_SearchPage_invalid(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if _, _, err := svc.SearchPage(ctx, "jump", "not a cursor!", 2); err == nil {
+		t.Error("Service.SearchPage() with a malformed cursor should return an error")
+	}
+	if _, _, err := svc.SearchPage(ctx, "jump", "", 0); err == nil {
+		t.Error("Service.SearchPage() with a zero pageSize should return an error")
+	}
+}
+
+func TestService_SearchPage_compacted(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService(WithCompactThreshold(1))
+	var docs []Doc
+	for id := uint64(1); id <= 5; id++ {
+		docs = append(docs, Doc{ID: id, Text: fmt.Sprintf("pickled peppers batch %d", id)})
+	}
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	ids, next, err := svc.SearchPage(ctx, "pickled", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{1, 2}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("Service.SearchPage() = %v, want %v", ids, want)
+	}
+	// the delete crosses the threshold and compacts, renumbering the remaining documents
+	if err := svc.Delete(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.SearchPage(ctx, "pickled", next, 2); !errors.Is(err, ErrCursorExpired) {
+		t.Errorf("Service.SearchPage() error = %v after compaction, want %v", err, ErrCursorExpired)
+	}
+}
@@ -0,0 +1,195 @@
+package fulltext
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/dgryski/go-trigram"
+)
+
+// docsMagic identifies the format written by SaveDocs, which records the pruned trigrams
+// before the documents.  LoadDocs also reads docsMagicV1, the earlier format without
+// them.
+const (
+	docsMagic   = "FTDOCS2\n"
+	docsMagicV1 = "FTDOCS1\n"
+)
+
+// SaveDocs writes the external ID and text of every document to w, in insertion (or
+// canonical) order, as a gzip compressed stream from which LoadDocs rebuilds the index.
+// The trigrams pruned as too common are saved too, so that LoadDocs reproduces the
+// candidates of every query.  The index is read locked while the documents are written.
+func (svc *Service) SaveDocs(w io.Writer) error {
+	svc.RLock()
+	defer svc.RUnlock()
+	docIDs := svc.docOrder(svc.docs)
+	zw := gzip.NewWriter(w)
+	bw := bufio.NewWriter(zw)
+	if _, err := bw.WriteString(docsMagic); err != nil {
+		return err
+	}
+	var header [2 * binary.MaxVarintLen64]byte
+	pruned := svc.pruned()
+	n := binary.PutUvarint(header[:], uint64(len(pruned)))
+	if _, err := bw.Write(header[:n]); err != nil {
+		return err
+	}
+	for _, t := range pruned {
+		n := binary.PutUvarint(header[:], uint64(t))
+		if _, err := bw.Write(header[:n]); err != nil {
+			return err
+		}
+	}
+	for _, docID := range docIDs {
+		doc := svc.docs[docID]
+		n := binary.PutUvarint(header[:], doc.id)
+		n += binary.PutUvarint(header[n:], uint64(len(doc.text)))
+		if _, err := bw.Write(header[:n]); err != nil {
+			return err
+		}
+		if _, err := bw.WriteString(doc.text); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// pruned returns the pruned trigrams in ascending order.  The caller must hold the lock.
+func (svc *Service) pruned() (pruned []trigram.T) {
+	svc.idx.Range(func(t trigram.T, docIDs []trigram.DocID) {
+		if t != trigram.TAllDocIDs && docIDs == nil {
+			pruned = append(pruned, t)
+		}
+	})
+	sort.Slice(pruned, func(i, j int) bool { return pruned[i] < pruned[j] })
+	return pruned
+}
+
+// LoadDocs returns a new Service configured with opts and holding the documents
+// written by SaveDocs.  The Service must be configured as the saved one was, in
+// particular with the same Tokenizer, for queries to match as they did before.  The
+// trigrams pruned when the documents were saved are pruned in the new Service, and no
+// others, until it is next updated; input written before SaveDocs recorded them is
+// pruned as a single Upsert would prune it.
+func LoadDocs(r io.Reader, opts ...Option) (*Service, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	br := bufio.NewReader(zr)
+	magic := make([]byte, len(docsMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || (string(magic) != docsMagic && string(magic) != docsMagicV1) {
+		return nil, fmt.Errorf(`input was not written by SaveDocs`)
+	}
+	var pruned []trigram.T
+	if string(magic) == docsMagic {
+		if pruned, err = readPruned(br); err != nil {
+			return nil, err
+		}
+	}
+	var docs []Doc
+	seen := make(map[uint64]bool)
+	for {
+		id, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf(`reading document %d: %w`, len(docs), err)
+		}
+		length, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, fmt.Errorf(`reading document %d: %w`, len(docs), unexpected(err))
+		}
+		// read through a LimitReader rather than allocating length bytes up front, so a
+		// corrupt length cannot exhaust memory
+		text, err := io.ReadAll(io.LimitReader(br, int64(length)))
+		if err != nil {
+			return nil, fmt.Errorf(`reading document %d: %w`, len(docs), err)
+		}
+		if uint64(len(text)) != length {
+			return nil, fmt.Errorf(`reading document %d: %w`, len(docs), io.ErrUnexpectedEOF)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf(`reading document %d: ID %d is repeated`, len(docs), id)
+		}
+		seen[id] = true
+		docs = append(docs, Doc{ID: id, Text: string(text)})
+	}
+	svc := NewService(opts...)
+	if pruned == nil {
+		if err := svc.Upsert(context.Background(), docs); err != nil {
+			return nil, err
+		}
+		return svc, nil
+	}
+	if err := svc.restore(docs, pruned); err != nil {
+		return nil, err
+	}
+	return svc, nil
+}
+
+// readPruned reads the pruned trigrams recorded by SaveDocs
+func readPruned(br *bufio.Reader) ([]trigram.T, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf(`reading pruned trigrams: %w`, unexpected(err))
+	}
+	// grow as trigrams are read rather than trusting n, so a corrupt count cannot exhaust
+	// memory
+	pruned := []trigram.T{}
+	for i := uint64(0); i < n; i++ {
+		t, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, fmt.Errorf(`reading pruned trigram %d: %w`, i, unexpected(err))
+		}
+		if t > uint64(^trigram.T(0)) {
+			return nil, fmt.Errorf(`reading pruned trigram %d: %d is not a trigram`, i, t)
+		}
+		pruned = append(pruned, trigram.T(t))
+	}
+	return pruned, nil
+}
+
+// restore indexes docs with exactly the given trigrams pruned, rather than pruning as
+// Upsert would.  The index offers no way to prune a particular trigram, but it prunes
+// for good every trigram in more than none of the documents when told to prune with a
+// fraction of zero, and documents added later are never listed under a pruned trigram.
+// So a placeholder document containing just the trigrams to prune is added and pruned
+// away before the real documents, leaving an internal ID that is registered with the
+// trigram index but holds no document, as updates do.
+func (svc *Service) restore(docs []Doc, pruned []trigram.T) error {
+	p := svc.startProgress()
+	defer p.stop() // after the lock is released
+	svc.Lock()
+	defer svc.Unlock()
+	if err := svc.validate(docs); err != nil {
+		return err
+	}
+	if len(pruned) > 0 {
+		svc.idx.AddTrigrams(pruned)
+		svc.idx.Prune(0)
+	}
+	svc.add(docs, p)
+	svc.idx.Sort()
+	return nil
+}
+
+// unexpected converts io.EOF, which means the input ended in the middle of a record, to
+// io.ErrUnexpectedEOF
+func unexpected(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,231 @@
+package fulltext
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/dgryski/go-trigram"
+)
+
+func TestLoadDocs(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docThree, docOne, docTwo}); err != nil {
+		t.Fatal(err)
+	}
+	update := Doc{ID: docOne.ID, Text: "The quick brown fox naps", PriorText: docOne.Text}
+	if err := svc.Upsert(ctx, []Doc{update}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := svc.SaveDocs(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadDocs(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := loaded.IDs(), svc.IDs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadDocs() IDs = %v, want %v", got, want)
+	}
+	for _, query := range []string{"the", "naps", "jumps", "sea", "peter pep", "zebra"} {
+		want, err := svc.Search(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := loaded.Search(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("LoadDocs() Search(%q) = %v, want %v", query, got, want)
+		}
+	}
+	if err := loaded.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestService_SaveDocs_canonicalOrder(t *testing.T) {
+	ctx := context.TODO()
+	// one Upsert in external ID order
+	sorted := NewService(WithCanonicalOrder())
+	if err := sorted.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	// one Upsert in another order
+	batch := NewService(WithCanonicalOrder())
+	if err := batch.Upsert(ctx, []Doc{docThree, docOne, docTwo}); err != nil {
+		t.Fatal(err)
+	}
+	// separate Upserts in another order, with an update, then a Reindex
+	incremental := NewService(WithCanonicalOrder())
+	for _, doc := range []Doc{docTwo, {ID: docOne.ID, Text: "The quick brown fox naps"}, docThree} {
+		if err := incremental.Upsert(ctx, []Doc{doc}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	update := Doc{ID: docOne.ID, Text: docOne.Text, PriorText: "The quick brown fox naps"}
+	if err := incremental.Upsert(ctx, []Doc{update}); err != nil {
+		t.Fatal(err)
+	}
+	incremental.Reindex()
+	var want bytes.Buffer
+	if err := sorted.SaveDocs(&want); err != nil {
+		t.Fatal(err)
+	}
+	for name, svc := range map[string]*Service{"batch": batch, "incremental": incremental} {
+		var got bytes.Buffer
+		if err := svc.SaveDocs(&got); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("%s Service.SaveDocs() output differs from that of an index built in external ID order", name)
+		}
+		if !reflect.DeepEqual(svc.extIDs, sorted.extIDs) {
+			t.Errorf("%s internal IDs = %v, want %v", name, svc.extIDs, sorted.extIDs)
+		}
+	}
+	// without canonical order the output reflects insertion order
+	var got, insertion bytes.Buffer
+	unordered := NewService()
+	if err := unordered.Upsert(ctx, []Doc{docThree, docOne, docTwo}); err != nil {
+		t.Fatal(err)
+	}
+	if err := unordered.SaveDocs(&insertion); err != nil {
+		t.Fatal(err)
+	}
+	if err := sorted.SaveDocs(&got); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(got.Bytes(), insertion.Bytes()) {
+		t.Error("Service.SaveDocs() output should follow insertion order without WithCanonicalOrder")
+	}
+}
+
+func TestLoadDocs_errors(t *testing.T) {
+	var buf bytes.Buffer
+	svc := NewService()
+	if err := svc.Upsert(context.TODO(), []Doc{docOne}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.SaveDocs(&buf); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{name: "not gzip", input: []byte("not gzip")},
+		{name: "truncated", input: buf.Bytes()[:buf.Len()-12]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadDocs(bytes.NewReader(tt.input)); err == nil {
+				t.Error("LoadDocs() should fail")
+			}
+		})
+	}
+}
+
+func TestLoadDocs_pruned(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	// indexed alone, every trigram of "zebra" is in all of the documents, so each is
+	// pruned and stays pruned as the fillers are added
+	if err := svc.Upsert(ctx, []Doc{{ID: 1, Text: "zebra crossing"}}); err != nil {
+		t.Fatal(err)
+	}
+	var docs []Doc
+	for id := uint64(2); id <= 30; id++ {
+		docs = append(docs, Doc{ID: id, Text: fmt.Sprintf("filler%d", id)})
+	}
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := svc.SaveDocs(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadDocs(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := loaded.pruned(), svc.pruned(); !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadDocs() pruned %d trigrams, want %d", len(got), len(want))
+	}
+	// rebuilt in a single batch, the trigrams of "zebra" are no longer too common
+	rebuilt := NewService()
+	if err := rebuilt.Upsert(ctx, append(docs, Doc{ID: 1, Text: "zebra crossing"})); err != nil {
+		t.Fatal(err)
+	}
+	if estimate, err := rebuilt.EstimateMatches(ctx, "zebra"); err != nil || estimate != 1 {
+		t.Fatalf("rebuilt Service.EstimateMatches() = %d, %v, want 1, nil", estimate, err)
+	}
+	for _, query := range []string{"zebra", "crossing", "filler1", "filler25"} {
+		want, err := svc.EstimateMatches(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a fully pruned query counts every internal ID ever assigned, which in the
+		// loaded index includes the one that restored the pruned trigrams
+		if all, _ := svc.idx.Posting(trigram.TAllDocIDs); want == len(all) {
+			all, _ = loaded.idx.Posting(trigram.TAllDocIDs)
+			want = len(all)
+		}
+		got, err := loaded.EstimateMatches(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("LoadDocs() EstimateMatches(%q) = %d, want %d", query, got, want)
+		}
+		wantIDs, _, err := svc.SearchWith(ctx, query, SearchOptions{MaxCandidates: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotIDs, _, err := loaded.SearchWith(ctx, query, SearchOptions{MaxCandidates: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(gotIDs, wantIDs) {
+			t.Errorf("LoadDocs() SearchWith(%q) = %v, want %v", query, gotIDs, wantIDs)
+		}
+	}
+	if err := loaded.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadDocs_v1(t *testing.T) {
+	// the format written before pruned trigrams were recorded
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(docsMagicV1))
+	for _, doc := range []Doc{docOne, docTwo} {
+		var header [2 * binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(header[:], doc.ID)
+		n += binary.PutUvarint(header[n:], uint64(len(doc.Text)))
+		zw.Write(header[:n])
+		zw.Write([]byte(doc.Text))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadDocs(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := loaded.Search(context.TODO(), "sea")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{docTwo.ID}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadDocs() Search() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,60 @@
+package fulltext
+
+import (
+	"context"
+	"time"
+
+	"github.com/dgryski/go-trigram"
+)
+
+// SearchProfile breaks down the work done by a search, for diagnosing slow queries
+type SearchProfile struct {
+	CandidateTime  time.Duration // time spent generating candidates from the trigram index
+	Candidates     int           // internal IDs returned by the trigram index
+	Stale          int           // candidates retired by updates and deletes, skipped without verification
+	VerifyTime     time.Duration // time spent verifying candidates against their suffix arrays
+	FalsePositives int           // verified candidates that did not contain the query words
+}
+
+// SearchProfile performs the same search as Search and also reports how long candidate
+// generation and verification took and how many candidates each stage handled.  Every
+// candidate is accounted for: Candidates equals the number of results plus Stale plus
+// FalsePositives.  Time spent waiting for locks and analyzing the query is not included.
+func (svc *Service) SearchProfile(ctx context.Context, query string) (ids []uint64, profile SearchProfile, err error) {
+	if err := svc.acquireSearch(); err != nil {
+		return nil, profile, err
+	}
+	defer svc.releaseSearch()
+	q, err := svc.newQuery(query, SearchOptions{})
+	if err != nil {
+		return nil, profile, err
+	}
+	defer q.release()
+	svc.RLock()
+	defer svc.RUnlock()
+	start := time.Now()
+	candidates := svc.queryCandidates(q)
+	profile.CandidateTime = time.Since(start)
+	profile.Candidates = len(candidates)
+	start = time.Now()
+	ids = make([]uint64, 0, len(candidates))
+	var verified int
+	match := func(doc meta) bool {
+		verified++
+		if !q.matches(doc) {
+			profile.FalsePositives++
+			return false
+		}
+		return true
+	}
+	err = svc.verify(ctx, candidates, match, func(_ trigram.DocID, doc meta) bool {
+		ids = append(ids, doc.id)
+		return true
+	})
+	if err != nil {
+		return nil, profile, err
+	}
+	profile.Stale = len(candidates) - verified
+	profile.VerifyTime = time.Since(start)
+	return ids, profile, nil
+}
@@ -0,0 +1,54 @@
+package fulltext
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestService_SearchProfile(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, skewedCorpus()); err != nil {
+		t.Fatal(err)
+	}
+	// an inaccurate PriorText leaves the retired internal ID in the posting lists of "bravo"
+	update := Doc{ID: 1, Text: "alpha bravo filler1 updated", PriorText: "alpha filler1"}
+	if err := svc.Upsert(ctx, []Doc{update}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query              string
+		wantCandidates     int
+		wantFalsePositives int
+		wantStale          int
+	}{
+		{query: "bravo", wantCandidates: 91, wantFalsePositives: 80, wantStale: 1},
+		{query: "avocado", wantCandidates: 80},
+		{query: "zebra"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, profile, err := svc.SearchProfile(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := svc.Search(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Service.SearchProfile() = %v, want %v", got, want)
+			}
+			if profile.Candidates < len(got) {
+				t.Errorf("profile.Candidates = %d, fewer than the %d results", profile.Candidates, len(got))
+			}
+			if profile.Candidates != len(got)+profile.Stale+profile.FalsePositives {
+				t.Errorf("profile %+v does not account for %d results", profile, len(got))
+			}
+			if profile.Candidates != tt.wantCandidates || profile.FalsePositives != tt.wantFalsePositives || profile.Stale != tt.wantStale {
+				t.Errorf("profile = %+v, want %d candidates, %d false positives and %d stale", profile, tt.wantCandidates, tt.wantFalsePositives, tt.wantStale)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package fulltext
+
+import "sync"
+
+// progress reports the number of documents an Upsert or UpsertReader has indexed to the
+// callback registered with WithProgress.  Counts are queued while the write lock is held
+// and delivered from a separate goroutine, so a callback that calls back into the
+// Service merely waits for the lock instead of deadlocking.  A nil *progress reports
+// nothing.
+type progress struct {
+	every    int
+	fn       func(done int)
+	done     int           // documents indexed so far
+	mu       sync.Mutex    // guards pending
+	pending  []int         // counts not yet delivered to fn
+	wake     chan struct{} // signals the delivery goroutine that pending is not empty
+	finished chan struct{} // closed once every count has been delivered
+}
+
+// startProgress starts delivering progress for an Upsert or UpsertReader, returning nil
+// when no callback is registered.  Every call must be paired with a call to stop.
+func (svc *Service) startProgress() *progress {
+	if svc.progressFn == nil {
+		return nil
+	}
+	p := &progress{
+		every:    svc.progressEvery,
+		fn:       svc.progressFn,
+		wake:     make(chan struct{}, 1),
+		finished: make(chan struct{}),
+	}
+	go p.deliver()
+	return p
+}
+
+// advance counts an indexed document, queueing a report every p.every documents
+func (p *progress) advance() {
+	if p == nil {
+		return
+	}
+	p.done++
+	if p.done%p.every != 0 {
+		return
+	}
+	p.mu.Lock()
+	p.pending = append(p.pending, p.done)
+	p.mu.Unlock()
+	select {
+	case p.wake <- struct{}{}:
+	default: // the delivery goroutine has yet to take the last signal
+	}
+}
+
+// deliver calls fn with each queued count, in order, until stop is called
+func (p *progress) deliver() {
+	defer close(p.finished)
+	for range p.wake {
+		p.mu.Lock()
+		counts := p.pending
+		p.pending = nil
+		p.mu.Unlock()
+		for _, done := range counts {
+			p.fn(done)
+		}
+	}
+}
+
+// stop waits for every queued count to be delivered.  The caller must not hold the
+// lock, which the callback may be waiting for.
+func (p *progress) stop() {
+	if p == nil {
+		return
+	}
+	close(p.wake)
+	<-p.finished
+}
@@ -0,0 +1,61 @@
+package fulltext
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestService_progress(t *testing.T) {
+	ctx := context.TODO()
+	var reports, counts []int
+	var svc *Service
+	svc = NewService(WithProgress(10, func(done int) {
+		reports = append(reports, done)
+		// calling back into the Service waits for the Upsert to release the lock
+		counts = append(counts, svc.DocCount())
+	}))
+	var docs []Doc
+	for id := uint64(1); id <= 25; id++ {
+		docs = append(docs, Doc{ID: id, Text: fmt.Sprintf("document%d", id)})
+	}
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{10, 20}; !reflect.DeepEqual(reports, want) {
+		t.Errorf("Service.Upsert() reported %v, want %v", reports, want)
+	}
+	if want := []int{25, 25}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("Service.DocCount() = %v from the progress callback, want %v", counts, want)
+	}
+
+	reports = nil
+	if err := svc.Upsert(ctx, []Doc{{ID: 0, Text: "invalid"}}); err == nil {
+		t.Fatal("Service.Upsert() should reject a zero ID")
+	}
+	if len(reports) != 0 {
+		t.Errorf("Service.Upsert() of a rejected batch reported %v", reports)
+	}
+
+	var lines strings.Builder
+	for i := 1; i <= readerBatchSize+500; i++ {
+		fmt.Fprintf(&lines, "record%d\n", i)
+	}
+	var id uint64
+	err := svc.UpsertReader(ctx, strings.NewReader(lines.String()), bufio.ScanLines, func(string) uint64 {
+		id++
+		return 100 + id
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(reports), (readerBatchSize+500)/10; got != want {
+		t.Errorf("Service.UpsertReader() reported %d times, want %d", got, want)
+	}
+	if last := reports[len(reports)-1]; last != readerBatchSize+500 {
+		t.Errorf("Service.UpsertReader() last reported %d, want %d", last, readerBatchSize+500)
+	}
+}
@@ -0,0 +1,88 @@
+package fulltext
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+)
+
+// readerBatchSize is the number of records UpsertReader indexes under a single write lock
+const readerBatchSize = 1000
+
+// UpsertReader indexes each record scanned from r using split as a document, deriving
+// the document's external ID from its text with idFn.  Use bufio.ScanLines to load a
+// corpus file with one document per line.  Records are upserted in batches as they are
+// read, so the corpus is never held in memory at once and readers are not blocked for
+// the whole load.  A record whose ID is already indexed replaces the stored document;
+// PriorText is taken from the index.  Empty records are skipped.  ctx is checked
+// between records, and if it is cancelled or an error occurs, the batches already
+// flushed remain indexed.  A successful load makes a Service created with
+// WithInitialLoad ready.  Progress registered with WithProgress counts records across
+// the whole load.
+func (svc *Service) UpsertReader(ctx context.Context, r io.Reader, split bufio.SplitFunc, idFn func(text string) uint64) error {
+	p := svc.startProgress()
+	defer p.stop()
+	scanner := bufio.NewScanner(r)
+	scanner.Split(split)
+	batch := make([]Doc, 0, readerBatchSize)
+	pending := make(map[uint64]bool, readerBatchSize)
+	flush := func() error {
+		err := svc.upsertRecords(batch, p)
+		batch = batch[:0]
+		clear(pending)
+		return err
+	}
+	for n := 1; scanner.Scan(); n++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		text := scanner.Text()
+		if len(text) == 0 {
+			continue
+		}
+		id := idFn(text)
+		if id == 0 {
+			return fmt.Errorf(`record %d: ID must be greater than zero`, n)
+		}
+		if err := svc.checkLength(text); err != nil {
+			return fmt.Errorf(`record %d: %w`, n, err)
+		}
+		// a record repeating an ID in the batch must see the earlier record as its prior text
+		if pending[id] || len(batch) == readerBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		batch = append(batch, Doc{ID: id, Text: text})
+		pending[id] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	svc.MarkReady()
+	return nil
+}
+
+// upsertRecords upserts docs, filling in PriorText for documents already indexed and
+// counting each with p
+func (svc *Service) upsertRecords(docs []Doc, p *progress) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	svc.Lock()
+	defer svc.Unlock()
+	for i, doc := range docs {
+		if docID, ok := svc.extIDs[doc.ID]; ok {
+			docs[i].PriorText = svc.docs[docID].text
+		}
+	}
+	if err := svc.checkDuplicates(docs); err != nil {
+		return err
+	}
+	svc.upsert(docs, p)
+	return nil
+}
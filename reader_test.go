@@ -0,0 +1,88 @@
+package fulltext
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// leadingID parses the number at the start of a record
+func leadingID(text string) uint64 {
+	id, _ := strconv.ParseUint(strings.Fields(text)[0], 10, 64)
+	return id
+}
+
+func TestService_UpsertReader(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	corpus := strings.Join([]string{
+		"1 The quick brown fox",
+		"2 She sells sea shells",
+		"",
+		"3 Peter Piper picked a peck",
+		"2 She sells sea glass",
+	}, "\n")
+	if err := svc.UpsertReader(ctx, strings.NewReader(corpus), bufio.ScanLines, leadingID); err != nil {
+		t.Fatal(err)
+	}
+	if got := svc.DocCount(); got != 3 {
+		t.Errorf("Service.DocCount() = %d, want %d", got, 3)
+	}
+	tests := []struct {
+		query string
+		want  []uint64
+	}{
+		{query: "fox", want: []uint64{1}},
+		{query: "peck", want: []uint64{3}},
+		{query: "glass", want: []uint64{2}},
+		{query: "shells", want: []uint64{}},
+	}
+	for _, tt := range tests {
+		got, err := svc.Search(ctx, tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Service.Search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+	if err := svc.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestService_UpsertReader_batches(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	var b strings.Builder
+	n := 2*readerBatchSize + 1
+	for id := 1; id <= n; id++ {
+		fmt.Fprintf(&b, "%d record\n", id)
+	}
+	if err := svc.UpsertReader(ctx, strings.NewReader(b.String()), bufio.ScanLines, leadingID); err != nil {
+		t.Fatal(err)
+	}
+	if got := svc.DocCount(); got != n {
+		t.Errorf("Service.DocCount() = %d, want %d", got, n)
+	}
+}
+
+func TestService_UpsertReader_errors(t *testing.T) {
+	svc := NewService()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := svc.UpsertReader(ctx, strings.NewReader("1 fox"), bufio.ScanLines, leadingID); err != context.Canceled {
+		t.Errorf("Service.UpsertReader() error = %v, want %v", err, context.Canceled)
+	}
+	err := svc.UpsertReader(context.TODO(), strings.NewReader("1 fox\nzero\n"), bufio.ScanLines, leadingID)
+	if err == nil || !strings.Contains(err.Error(), "record 2") {
+		t.Errorf("Service.UpsertReader() error = %v, want an error for record 2", err)
+	}
+	if got := svc.DocCount(); got != 0 {
+		t.Errorf("Service.DocCount() = %d, want %d: records are not flushed after an error", got, 0)
+	}
+}
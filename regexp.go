@@ -0,0 +1,42 @@
+package fulltext
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/dgryski/go-trigram"
+)
+
+// SearchRegexp returns the external IDs of up to limit documents matching re, in the
+// order Search would return them.  A limit of zero or less returns every match.
+//
+// re is matched against the words each document was indexed under rather than its
+// original text: words are normalized by the Tokenizer, and each is preceded by a NUL
+// byte and, unless WithSubstringMatching is enabled, an underscore marking the start of
+// the word, so `_pe+r` matches words beginning with "per" or "peer".  Secondary forms
+// indexed by WithSecondaryAnalyzer follow the words, each beginning with a 0xfd byte.
+// Arbitrary regular expressions yield no trigrams to narrow the search, so every
+// document is scanned with its suffix array.  SearchRegexp is meant for administrative
+// and debugging use, not for typeahead.  ctx is checked between documents.
+func (svc *Service) SearchRegexp(ctx context.Context, re *regexp.Regexp, limit int) ([]uint64, error) {
+	if re == nil {
+		return nil, fmt.Errorf(`a regular expression is required`)
+	}
+	if err := svc.acquireSearch(); err != nil {
+		return nil, err
+	}
+	defer svc.releaseSearch()
+	svc.RLock()
+	defer svc.RUnlock()
+	ids := []uint64{}
+	match := func(doc meta) bool { return len(doc.sa.FindAllIndex(re, 1)) > 0 }
+	err := svc.verify(ctx, svc.liveDocIDs(), match, func(_ trigram.DocID, doc meta) bool {
+		ids = append(ids, doc.id)
+		return len(ids) != limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
@@ -0,0 +1,53 @@
+package fulltext
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestService_SearchRegexp(t *testing.T) {
+	ctx := context.TODO()
+	services := map[string]*Service{
+		"suffix arrays": NewService(),
+		"scanned":       NewService(WithMaxSuffixArrayBytes(1)),
+	}
+	tests := []struct {
+		pattern string
+		limit   int
+		want    []uint64
+	}{
+		{pattern: `pe+r`, want: []uint64{docThree.ID}},
+		{pattern: `_pe+r`, want: []uint64{}},
+		{pattern: `_sh?e`, want: []uint64{docTwo.ID, docThree.ID}},
+		{pattern: `e+`, limit: 2, want: []uint64{docOne.ID, docTwo.ID}},
+		{pattern: `e+`, want: []uint64{docOne.ID, docTwo.ID, docThree.ID}},
+		{pattern: `_l[a-z]*y\x00`, want: []uint64{docOne.ID}},
+		{pattern: `zebra`, want: []uint64{}},
+	}
+	for name, svc := range services {
+		if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.pattern, func(t *testing.T) {
+				got, err := svc.SearchRegexp(ctx, regexp.MustCompile(tt.pattern), tt.limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Service.SearchRegexp() = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := services["suffix arrays"].SearchRegexp(cancelled, regexp.MustCompile(`pe+r`), 0); err == nil {
+		t.Error("Service.SearchRegexp() with a cancelled context did not return an error")
+	}
+	if _, err := services["suffix arrays"].SearchRegexp(ctx, nil, 0); err == nil {
+		t.Error("Service.SearchRegexp() with a nil regular expression did not return an error")
+	}
+}
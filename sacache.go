@@ -0,0 +1,201 @@
+package fulltext
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"index/suffixarray"
+	"regexp"
+	"sync"
+)
+
+// suffixArray is the suffix array of a document's delimited words.  When the Service
+// caps the number of resident suffix arrays, the index may be evicted and is rebuilt
+// from data the next time it is needed.  Documents too large for a suffix array under
+// WithMaxSuffixArrayBytes never build one, and are scanned instead.
+type suffixArray struct {
+	data  []byte             // the delimited words indexed by the suffix array
+	idx   *suffixarray.Index // nil while evicted; guarded by cache.mu when cache is not nil
+	cache *saCache           // nil when every suffix array stays resident
+	elem  *list.Element      // position in the cache's LRU list; nil while evicted
+	scan  bool               // whether lookups scan data because no index is ever built
+}
+
+// Lookup behaves like suffixarray.Index.Lookup
+func (sa *suffixArray) Lookup(s []byte, n int) []int {
+	if sa.scan {
+		return scanLookup(sa.data, s, n)
+	}
+	return sa.index().Lookup(s, n)
+}
+
+// FindAllIndex behaves like suffixarray.Index.FindAllIndex
+func (sa *suffixArray) FindAllIndex(r *regexp.Regexp, n int) [][]int {
+	if sa.scan {
+		return r.FindAllIndex(sa.data, n)
+	}
+	return sa.index().FindAllIndex(r, n)
+}
+
+// shortSuffixArrayBytes is the size of data below which contains scans data rather than
+// looking s up in the index.  Scanning a short document is about as fast as a lookup,
+// and unlike Lookup it does not allocate a slice of offsets.
+const shortSuffixArrayBytes = 256
+
+// contains reports whether s occurs in the data indexed by the suffix array
+func (sa *suffixArray) contains(s []byte) bool {
+	if sa.scan || len(sa.data) <= shortSuffixArrayBytes {
+		return len(s) > 0 && bytes.Contains(sa.data, s)
+	}
+	return sa.index().Lookup(s, 1) != nil
+}
+
+// scanLookup returns, in ascending order, the offsets of at most n occurrences of s in
+// data, or of every occurrence if n < 0, including overlapping ones as a suffix array
+// would.  Like suffixarray.Index.Lookup, it returns nil when s is empty or n is zero.
+func scanLookup(data, s []byte, n int) (offsets []int) {
+	if len(s) == 0 || n == 0 {
+		return nil
+	}
+	for start := 0; n < 0 || len(offsets) < n; {
+		i := bytes.Index(data[start:], s)
+		if i < 0 {
+			break
+		}
+		offsets = append(offsets, start+i)
+		start += i + 1
+	}
+	return offsets
+}
+
+// ready waits until the suffix array index is resident or ctx is done.  Searches check
+// their context between candidates, and lookups in a resident suffix array take time
+// logarithmic in the size of the document, so the only verification step that can
+// take long enough to overrun a deadline is rebuilding an evicted suffix array, which
+// is linear in the size of the document.  ready runs such rebuilds in a goroutine so
+// that the search can give up when ctx is done; an abandoned rebuild runs to completion
+// and leaves the index resident for the next search that needs it.
+func (sa *suffixArray) ready(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if sa.cache == nil || sa.cache.isResident(sa) {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sa.cache.load(sa)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Bytes returns the data the suffix array was built from
+func (sa *suffixArray) Bytes() []byte {
+	return sa.data
+}
+
+// index returns the suffix array index, rebuilding it if it was evicted
+func (sa *suffixArray) index() *suffixarray.Index {
+	if sa.cache == nil {
+		return sa.idx
+	}
+	return sa.cache.load(sa)
+}
+
+// saCache bounds the number of resident suffix arrays, evicting the least recently used
+type saCache struct {
+	mu   sync.Mutex
+	max  int
+	lru  *list.List // of *suffixArray, most recently used first
+	hits int        // lookups served by a resident suffix array
+	miss int        // lookups that had to rebuild an evicted suffix array
+}
+
+func newSACache(max int) *saCache {
+	return &saCache{max: max, lru: list.New()}
+}
+
+// load returns the index of sa, rebuilding it and evicting the least recently used
+// suffix array if necessary.  The returned index remains valid after eviction.  The
+// rebuild happens without holding the cache lock, so lookups in other suffix arrays
+// are not blocked behind it.
+func (c *saCache) load(sa *suffixArray) *suffixarray.Index {
+	c.mu.Lock()
+	if sa.elem != nil {
+		c.hits++
+		c.lru.MoveToFront(sa.elem)
+		defer c.mu.Unlock()
+		return sa.idx
+	}
+	c.miss++
+	c.mu.Unlock()
+	idx := suffixarray.New(sa.data)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sa.elem != nil {
+		// another lookup rebuilt it first
+		c.lru.MoveToFront(sa.elem)
+		return sa.idx
+	}
+	sa.idx = idx
+	sa.elem = c.lru.PushFront(sa)
+	for c.lru.Len() > c.max {
+		c.evict(c.lru.Back().Value.(*suffixArray))
+	}
+	return sa.idx
+}
+
+// forget evicts sa, typically because its document was removed from the index
+func (c *saCache) forget(sa *suffixArray) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sa.elem != nil {
+		c.evict(sa)
+	}
+}
+
+func (c *saCache) evict(sa *suffixArray) {
+	c.lru.Remove(sa.elem)
+	sa.elem = nil
+	sa.idx = nil
+}
+
+// isResident reports whether the index of sa is held in memory
+func (c *saCache) isResident(sa *suffixArray) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return sa.elem != nil
+}
+
+// resident returns the number of suffix arrays currently held in memory
+func (c *saCache) resident() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// newSuffixArray returns a suffix array over data, which is built lazily when
+// the Service caps the number of resident suffix arrays
+func (svc *Service) newSuffixArray(data []byte) *suffixArray {
+	if svc.maxSABytes > 0 && len(data) > svc.maxSABytes {
+		return &suffixArray{data: data, scan: true}
+	}
+	if svc.saCache == nil {
+		return &suffixArray{data: data, idx: suffixarray.New(data)}
+	}
+	return &suffixArray{data: data, cache: svc.saCache}
+}
+
+// forget releases the resident suffix array of a document removed from the index.
+// The caller must hold the write lock.
+func (svc *Service) forget(doc meta) {
+	if doc.sa.cache != nil {
+		doc.sa.cache.forget(doc.sa)
+	}
+}
@@ -0,0 +1,179 @@
+package fulltext
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestService_maxSuffixArrays(t *testing.T) {
+	ctx := context.TODO()
+	unlimited := NewService()
+	capped := NewService(WithMaxSuffixArrays(1))
+	for _, svc := range []*Service{unlimited, capped} {
+		if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := capped.saCache.resident(); got != 0 {
+		t.Errorf("%d suffix arrays resident before any query, want 0", got)
+	}
+	queries := []string{"fox", "jump", "sea shells", "picpep", "pET PiP", "jump", "shore"}
+	for _, query := range queries {
+		want, err := unlimited.Search(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := capped.Search(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Service.Search(%q) = %v, want %v", query, got, want)
+		}
+		if n := capped.saCache.resident(); n > 1 {
+			t.Errorf("%d suffix arrays resident after %q, want at most 1", n, query)
+		}
+	}
+	if capped.saCache.miss <= 3 {
+		t.Errorf("only %d suffix arrays were built, expected evicted ones to be rebuilt", capped.saCache.miss)
+	}
+	// removing a document releases its suffix array
+	sa := capped.docs[capped.extIDs[docTwo.ID]].sa
+	sa.index()
+	if err := capped.Delete(ctx, docTwo.ID); err != nil {
+		t.Fatal(err)
+	}
+	if sa.elem != nil || sa.idx != nil {
+		t.Error("the suffix array of a deleted document is still resident")
+	}
+}
+
+func TestService_Search_rebuildDeadline(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService(WithMaxSuffixArrays(1), WithTokenizer(UnicodeTokenizer))
+	var b strings.Builder
+	for i := 0; i < 200000; i++ {
+		fmt.Fprintf(&b, "haystack%d ", i)
+	}
+	huge := Doc{ID: 100, Text: b.String() + "needle"}
+	if err := svc.Upsert(ctx, []Doc{huge, docOne}); err != nil {
+		t.Fatal(err)
+	}
+	// the huge document's suffix array has never been built, so verifying it requires a
+	// rebuild that takes far longer than the deadline
+	deadline, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	if _, err := svc.Search(deadline, "needle"); err != context.DeadlineExceeded {
+		t.Fatalf("Service.Search() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	// the abandoned rebuild completes in the background and later searches succeed
+	got, err := svc.Search(ctx, "needle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []uint64{huge.ID}) {
+		t.Errorf("Service.Search() = %v, want %v", got, []uint64{huge.ID})
+	}
+}
+
+func TestService_maxSuffixArrayBytes(t *testing.T) {
+	ctx := context.TODO()
+	huge := Doc{ID: 100, Text: strings.Repeat("sea shells and ", 50) + "a pickled pepper"}
+	docs := []Doc{docOne, docTwo, docThree, huge}
+	unlimited := NewService()
+	limited := NewService(WithMaxSuffixArrayBytes(200))
+	for _, svc := range []*Service{unlimited, limited} {
+		if err := svc.Upsert(ctx, docs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sa := limited.docs[limited.extIDs[huge.ID]].sa; !sa.scan || sa.idx != nil {
+		t.Error("the oversized document has a suffix array")
+	}
+	if sa := limited.docs[limited.extIDs[docTwo.ID]].sa; sa.scan {
+		t.Error("a document within the limit is scanned")
+	}
+	for _, query := range []string{"sea shells", "pickled pep", "pepper", "fox", "and sea"} {
+		for _, opts := range []SearchOptions{{}, {Order: OrderPosition}, {Anchor: AnchorWhole}, {Ordered: true}} {
+			want, _, err := unlimited.SearchWith(ctx, query, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _, err := limited.SearchWith(ctx, query, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Service.SearchWith(%q, %+v) = %v, want %v", query, opts, got, want)
+			}
+		}
+		want, err := unlimited.SearchCounts(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := limited.SearchCounts(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Service.SearchCounts(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestScanLookup(t *testing.T) {
+	data := []byte("\x00_aaa\x00_ab\x00")
+	tests := []struct {
+		s    string
+		n    int
+		want []int
+	}{
+		{s: "aa", n: -1, want: []int{2, 3}},
+		{s: "aa", n: 1, want: []int{2}},
+		{s: "_a", n: -1, want: []int{1, 6}},
+		{s: "_ab\x00", n: -1, want: []int{6}},
+		{s: "b_", n: -1, want: nil},
+		{s: "", n: -1, want: nil},
+		{s: "a", n: 0, want: nil},
+	}
+	for _, tt := range tests {
+		if got := scanLookup(data, []byte(tt.s), tt.n); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("scanLookup(%q, %d) = %v, want %v", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestService_SearchWith_partialOnDeadline(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService(WithMaxSuffixArrays(1), WithTokenizer(UnicodeTokenizer))
+	var b strings.Builder
+	for i := 0; i < 200000; i++ {
+		fmt.Fprintf(&b, "haystack%d ", i)
+	}
+	small := Doc{ID: 1, Text: "a needle"}
+	huge := Doc{ID: 100, Text: b.String() + "needle"}
+	if err := svc.Upsert(ctx, []Doc{small, huge}); err != nil {
+		t.Fatal(err)
+	}
+	// verifying the huge document requires a rebuild that takes far longer than the
+	// deadline, so only the small document is verified in time
+	deadline, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	got, partial, err := svc.SearchWith(deadline, "needle", SearchOptions{PartialOnDeadline: true})
+	if err != nil {
+		t.Fatalf("Service.SearchWith() error = %v, want partial results", err)
+	}
+	if !partial || !reflect.DeepEqual(got, []uint64{small.ID}) {
+		t.Errorf("Service.SearchWith() = %v, %t, want %v, true", got, partial, []uint64{small.ID})
+	}
+	// cancellation is still an error
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, err := svc.SearchWith(cancelled, "needle", SearchOptions{PartialOnDeadline: true}); err != context.Canceled {
+		t.Errorf("Service.SearchWith() error = %v after cancellation, want %v", err, context.Canceled)
+	}
+}
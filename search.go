@@ -0,0 +1,880 @@
+package fulltext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dgryski/go-trigram"
+)
+
+// Anchor determines where in an indexed word a query word may match
+type Anchor int
+
+const (
+	// AnchorPrefix matches query words against the beginning of indexed words
+	AnchorPrefix Anchor = iota
+	// AnchorWhole matches query words only when they equal an indexed word
+	AnchorWhole
+	// AnchorContains matches query words anywhere within an indexed word.
+	// Query words must be at least three characters long to produce any trigrams.
+	AnchorContains
+	// AnchorSuffix matches query words against the end of indexed words.  It requires
+	// a Service created with WithSuffixIndex.
+	AnchorSuffix
+)
+
+// Order determines the order of search results
+type Order int
+
+const (
+	// OrderNone returns results in the order they are verified, which is the order
+	// in which documents were added to the index
+	OrderNone Order = iota
+	// OrderIDAsc returns results in ascending order of external ID
+	OrderIDAsc
+	// OrderIDDesc returns results in descending order of external ID
+	OrderIDDesc
+	// OrderPosition returns documents in which a query word matches earliest first,
+	// which suits code and log search where the first occurrence is usually the most
+	// relevant.  Ties keep insertion order.  Finding the earliest match requires every
+	// occurrence of each query word to be looked up, so verification is slower.
+	OrderPosition
+)
+
+// ErrQueryTooBroad is returned by Search and SearchWith when a query has candidates in
+// a larger fraction of the documents than allowed by WithMaxQueryBreadth, so that a
+// typeahead client can prompt for more input rather than render a flood of suggestions
+var ErrQueryTooBroad = errors.New(`query matches too many documents`)
+
+// ErrBusy is returned by searches when the Service is already running as many searches
+// as WithMaxConcurrentSearches allows
+var ErrBusy = errors.New(`too many concurrent searches`)
+
+// ErrCursorExpired is returned by SearchPage when the index has been compacted since the
+// cursor was issued, reassigning the internal IDs it records; start again from the first page
+var ErrCursorExpired = errors.New(`cursor expired by compaction`)
+
+// acquireSearch claims a search slot, returning ErrBusy if every slot is in use.  Each
+// successful call must be paired with a call to releaseSearch.
+func (svc *Service) acquireSearch() error {
+	if svc.searchSlots == nil {
+		return nil
+	}
+	select {
+	case svc.searchSlots <- struct{}{}:
+		return nil
+	default:
+		return ErrBusy
+	}
+}
+
+// releaseSearch frees the search slot claimed by acquireSearch
+func (svc *Service) releaseSearch() {
+	if svc.searchSlots != nil {
+		<-svc.searchSlots
+	}
+}
+
+// SearchOptions customizes the behavior of SearchWith.  The zero value
+// reproduces the behavior of Search.
+type SearchOptions struct {
+	Anchor Anchor // where query words may match indexed words
+	// MaxCandidates bounds the number of trigram candidates verified against their
+	// suffix arrays, protecting against pathological queries that match a large share
+	// of the index.  When the limit is reached the results are not exhaustive.
+	// Zero means unlimited.
+	MaxCandidates int
+	// Ordered requires the query words to occur in the document in the order they were
+	// typed, though not necessarily adjacent to one another: with Ordered set, the query
+	// "peter peppers" matches "Peter Piper picked a peck of pickled peppers" but
+	// "peppers peter" does not.  A word repeated in the query must occur that many times.
+	// Only the words as typed satisfy the ordering, not their synonyms.
+	Ordered bool
+	Order   Order // the order in which results are returned
+	// MinTrigramCoverage lets a document match when the query words it contains account
+	// for at least this fraction of the query's distinct trigrams.  Zero requires every
+	// word.
+	MinTrigramCoverage float64
+	// PartialLastWord treats the last query word as still being typed, keeping only its
+	// first two characters, so that results stay stable while a word is completed or
+	// mistyped.  The other words must match as usual.  The shortened word is matched
+	// according to Anchor, so by default "pickled pepx" matches documents containing a
+	// word beginning with "pickled" and a word beginning with "pe".  A last word of two
+	// characters or fewer is unaffected.  Words removed by WithMinQueryWordLength are
+	// not considered, so the last word is the last one kept.
+	PartialLastWord bool
+	// Dedup keeps only the lowest external ID among results whose minhash fingerprints
+	// are near duplicates, so copies of the same text do not crowd out other suggestions.
+	Dedup bool
+	// DedupSimilarity is the estimated Jaccard index of two documents' trigram sets at
+	// or above which Dedup treats them as near duplicates.  Zero means
+	// DefaultDedupSimilarity.
+	DedupSimilarity float64
+	// PartialOnDeadline stops verification once 90% of the time left before ctx's
+	// deadline has elapsed, returning the documents verified so far with partial set.
+	PartialOnDeadline bool
+	// Secondary lets each query word match either as typed or by its secondary form,
+	// derived by the analyzer registered with WithSecondaryAnalyzer, so that with Soundex
+	// "smith" also matches "Smyth".  Secondary forms are matched by prefix, or whole under
+	// AnchorWhole.  Like synonyms, the alternatives are ORed for each word while every
+	// word must still match one way or the other.  MinTrigramCoverage ignores secondary
+	// forms, and Ordered is only satisfied by the words as typed.
+	Secondary bool
+}
+
+// analyzeQuery returns the trigrams used to generate candidates for query and the
+// strings that must appear in a candidate's suffix array for it to match.  The
+// trigrams are appended to tGrams, which may be nil or a slice borrowed from tGramPool.
+// Documents are always indexed with anchored words, so anchoring only changes
+// what is looked up: AnchorContains drops the word prefix, AnchorWhole appends the
+// suffix array delimiter that terminates each indexed word, and AnchorSuffix both drops
+// the prefix and appends the delimiter, generating candidates from the reversed forms
+// indexed by WithSuffixIndex.  Under WithSubstringMatching there is no prefix, so
+// AnchorPrefix matches like AnchorContains and AnchorWhole also prepends the delimiter.
+func (svc *Service) analyzeQuery(query string, opts SearchOptions, tGrams []trigram.T) ([]trigram.T, []string) {
+	words := svc.queryWords(query)
+	if opts.PartialLastWord && len(words) > 0 {
+		words[len(words)-1] = partial(words[len(words)-1])
+	}
+	switch opts.Anchor {
+	case AnchorContains:
+		for _, tok := range words {
+			tGrams = trigram.Extract(tok, tGrams)
+		}
+	case AnchorSuffix:
+		for i, tok := range words {
+			tGrams = trigram.Extract(suffixForm(tok), tGrams)
+			words[i] += saDelim
+		}
+	default:
+		tGrams = svc.anchor(words, tGrams)
+	}
+	if opts.Anchor == AnchorWhole {
+		for i := range words {
+			if svc.unanchored {
+				// without the anchor, only the preceding delimiter marks the start of a word
+				words[i] = saDelim + words[i]
+			}
+			words[i] += saDelim
+		}
+	}
+	return tGrams, words
+}
+
+// partialRunes is the number of leading runes of the last query word kept by
+// PartialLastWord.  Anchored, they make up the word's first trigram.
+const partialRunes = 2
+
+// partial returns the first partialRunes runes of an escaped word
+func partial(word string) string {
+	var n, i int
+	for i = range word {
+		if n == partialRunes {
+			return word[:i]
+		}
+		n++
+	}
+	return word
+}
+
+// queryWords tokenizes query, dropping blank words and ignoring words shorter than the
+// Service's minimum query word length unless that would leave no words at all
+func (svc *Service) queryWords(query string) []string {
+	words := slices.DeleteFunc(svc.tokenize(query), isBlank)
+	if svc.minQueryWordLen <= 1 {
+		return words
+	}
+	long := words[:0:0]
+	for _, word := range words {
+		if utf8.RuneCountInString(word) >= svc.minQueryWordLen {
+			long = append(long, word)
+		}
+	}
+	if len(long) == 0 {
+		return words
+	}
+	return long
+}
+
+// isBlank reports whether a word is empty or consists only of whitespace.  A custom
+// Tokenizer may produce such words from leading, trailing or repeated whitespace, and
+// left in a query they would match every document, or none under WithSubstringMatching,
+// since an empty string is never found in a suffix array.
+func isBlank(word string) bool {
+	return len(strings.TrimSpace(word)) == 0
+}
+
+// searchQuery is a query analyzed for a particular set of SearchOptions
+type searchQuery struct {
+	opts   SearchOptions
+	tGrams []trigram.T  // trigrams used to generate candidates
+	buf    *[]trigram.T // the pooled slice backing tGrams
+	words  []string     // strings each matching document's suffix array must contain
+	groups [][]string   // each word followed by its synonyms and secondary form; nil when it has neither
+	term   []byte       // the only word, when verifying it is all matching requires; see withTerm
+	broad  bool         // whether the query is exempt from WithMaxQueryBreadth
+}
+
+// newQuery analyzes query for the given options.  The caller must release the query
+// once candidates have been generated and verified.
+func (svc *Service) newQuery(query string, opts SearchOptions) (*searchQuery, error) {
+	if opts.Anchor == AnchorSuffix && !svc.suffixes {
+		return nil, fmt.Errorf(`suffix queries require a Service created with WithSuffixIndex`)
+	}
+	if opts.Secondary && svc.secondary == nil {
+		return nil, fmt.Errorf(`secondary queries require a Service created with WithSecondaryAnalyzer`)
+	}
+	buf := tGramPool.Get().(*[]trigram.T)
+	tGrams, words := svc.analyzeQuery(query, opts, (*buf)[:0])
+	if len(tGrams) == 0 {
+		tGramPool.Put(buf)
+		return nil, fmt.Errorf(`query '%s' does not have enough content`, query)
+	}
+	groups := svc.expand(words)
+	if opts.Secondary {
+		groups = svc.withSecondary(words, groups)
+	}
+	q := &searchQuery{
+		opts:   opts,
+		tGrams: tGrams,
+		buf:    buf,
+		words:  words,
+		groups: groups,
+	}
+	return q.withTerm(), nil
+}
+
+// newTermsQuery builds a query from terms that are already tokenized, escaping and
+// anchoring each as a single word.  The caller must release the query.
+func (svc *Service) newTermsQuery(terms []string) (*searchQuery, error) {
+	words := make([]string, 0, len(terms))
+	for _, term := range terms {
+		if !isBlank(term) {
+			words = append(words, term)
+		}
+	}
+	words = escape(svc.fold(words))
+	buf := tGramPool.Get().(*[]trigram.T)
+	tGrams := svc.anchor(words, (*buf)[:0])
+	if len(tGrams) == 0 {
+		tGramPool.Put(buf)
+		return nil, fmt.Errorf(`terms %q do not have enough content`, terms)
+	}
+	q := &searchQuery{
+		tGrams: tGrams,
+		buf:    buf,
+		words:  words,
+		groups: svc.expand(words),
+		broad:  true,
+	}
+	return q.withTerm(), nil
+}
+
+// withTerm sets up the fast path for the common typeahead query of a single word
+// without synonyms.  It needs no verification plan, and each candidate is verified by
+// suffixArray.contains, which avoids allocating for short documents, with a byte slice
+// converted once rather than per candidate.
+func (q *searchQuery) withTerm() *searchQuery {
+	if len(q.words) == 1 && q.groups == nil && !q.opts.Ordered && q.opts.MinTrigramCoverage == 0 {
+		q.term = []byte(q.words[0])
+	}
+	return q
+}
+
+// release returns q's trigram slice to the pool.  q must not be used afterwards.
+func (q *searchQuery) release() {
+	*q.buf = q.tGrams[:0]
+	tGramPool.Put(q.buf)
+	q.tGrams, q.buf = nil, nil
+}
+
+// queryCandidates returns the internal IDs of documents that may match q, in ascending
+// order, and orders q's words for verification.  When every trigram has been pruned,
+// QueryTrigrams returns every internal ID ever assigned, so verification scans every
+// document, skipping retired IDs.  The caller must hold the lock.
+func (svc *Service) queryCandidates(q *searchQuery) []trigram.DocID {
+	if !q.opts.Ordered && len(q.words) > 1 {
+		q.words = svc.plan(q.words)
+	}
+	switch {
+	case q.opts.MinTrigramCoverage > 0:
+		return svc.coveringCandidates(q.tGrams, q.opts.MinTrigramCoverage)
+	case q.groups != nil:
+		return svc.groupCandidates(q.groups)
+	default:
+		return svc.idx.QueryTrigrams(q.tGrams)
+	}
+}
+
+// verify calls fn, in order, with the internal ID of each candidate that is still
+// indexed and satisfies match, readying its suffix array first, until fn returns false.
+// ctx is checked between candidates.  The caller must hold the lock.
+func (svc *Service) verify(ctx context.Context, candidates []trigram.DocID, match func(doc meta) bool, fn func(docID trigram.DocID, doc meta) bool) error {
+	for _, docID := range candidates {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		doc, ok := svc.docs[docID]
+		if !ok {
+			continue
+		}
+		if err := doc.sa.ready(ctx); err != nil {
+			return err
+		}
+		if match(doc) && !fn(docID, doc) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// matches reports whether the document satisfies q, removing trigram false positives
+func (q *searchQuery) matches(doc meta) bool {
+	if q.term != nil {
+		return doc.sa.contains(q.term)
+	}
+	switch {
+	case q.opts.MinTrigramCoverage > 0:
+		if !doc.covers(q.words, q.opts.Anchor, len(q.tGrams), q.opts.MinTrigramCoverage) {
+			return false
+		}
+	case q.groups != nil:
+		if !doc.containsAny(q.groups) {
+			return false
+		}
+	default:
+		if !doc.contains(q.words) {
+			return false
+		}
+	}
+	return !q.opts.Ordered || doc.inOrder(q.words)
+}
+
+// SearchWith performs a fulltext search using the supplied options.
+// The returned docIDs are the external IDs provided at time of indexing.
+// partial is true when the search stopped before examining every candidate,
+// in which case other matching documents may exist.
+func (svc *Service) SearchWith(ctx context.Context, query string, opts SearchOptions) (docIDs []uint64, partial bool, err error) {
+	if err := svc.acquireSearch(); err != nil {
+		return nil, false, err
+	}
+	defer svc.releaseSearch()
+	q, err := svc.newQuery(query, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	defer q.release()
+	return svc.search(ctx, q)
+}
+
+// search implements SearchWith for an analyzed query
+func (svc *Service) search(ctx context.Context, q *searchQuery) (docIDs []uint64, partial bool, err error) {
+	opts := q.opts
+	svc.RLock()
+	defer svc.RUnlock()
+	candidates := svc.queryCandidates(q)
+	if !q.broad && svc.tooBroad(candidates) {
+		return nil, false, ErrQueryTooBroad
+	}
+	if opts.MaxCandidates > 0 && len(candidates) > opts.MaxCandidates {
+		candidates = candidates[:opts.MaxCandidates]
+		partial = true
+	}
+	verifyCtx := ctx
+	if deadline, ok := ctx.Deadline(); ok && opts.PartialOnDeadline {
+		var cancel context.CancelFunc
+		verifyCtx, cancel = context.WithDeadline(ctx, time.Now().Add(time.Until(deadline)*9/10))
+		defer cancel()
+	}
+	docIDs = make([]uint64, 0, len(candidates))
+	var positions []int
+	var matched []meta
+	err = svc.verify(verifyCtx, candidates, q.matches, func(_ trigram.DocID, doc meta) bool {
+		docIDs = append(docIDs, doc.id)
+		if opts.Order == OrderPosition {
+			positions = append(positions, q.position(doc))
+		}
+		if opts.Dedup {
+			matched = append(matched, doc)
+		}
+		return true
+	})
+	if err != nil {
+		if !opts.PartialOnDeadline || ctx.Err() == context.Canceled {
+			return nil, false, err
+		}
+		partial, err = true, nil
+	}
+	if opts.Dedup {
+		keep := representatives(matched, opts.DedupSimilarity)
+		n := 0
+		for i, id := range docIDs {
+			if !keep[id] {
+				continue
+			}
+			docIDs[n] = id
+			if positions != nil {
+				positions[n] = positions[i]
+			}
+			n++
+		}
+		docIDs = docIDs[:n]
+		if positions != nil {
+			positions = positions[:n]
+		}
+	}
+	switch opts.Order {
+	case OrderPosition:
+		sort.Stable(byPosition{docIDs, positions})
+	case OrderIDAsc:
+		sort.Slice(docIDs, func(i, j int) bool { return docIDs[i] < docIDs[j] })
+	case OrderIDDesc:
+		sort.Slice(docIDs, func(i, j int) bool { return docIDs[i] > docIDs[j] })
+	}
+	return
+}
+
+// alternatives returns q's words followed by their synonyms
+func (q *searchQuery) alternatives() []string {
+	words := q.words
+	for _, group := range q.groups {
+		words = append(words[:len(words):len(words)], group[1:]...)
+	}
+	return words
+}
+
+// position returns the earliest offset in the document's suffix array at which any
+// of q's words, or their synonyms, match
+func (q *searchQuery) position(doc meta) int {
+	min := -1
+	for _, word := range q.alternatives() {
+		for _, offset := range doc.sa.Lookup([]byte(word), -1) {
+			if min < 0 || offset < min {
+				min = offset
+			}
+		}
+	}
+	return min
+}
+
+// hits returns the number of times q's words, and their synonyms, match in the document
+func (q *searchQuery) hits(doc meta) (n int) {
+	for _, word := range q.alternatives() {
+		n += len(doc.sa.Lookup([]byte(word), -1))
+	}
+	return
+}
+
+// byPosition sorts external IDs by the position of their earliest match
+type byPosition struct {
+	docIDs    []uint64
+	positions []int
+}
+
+func (p byPosition) Len() int           { return len(p.docIDs) }
+func (p byPosition) Less(i, j int) bool { return p.positions[i] < p.positions[j] }
+func (p byPosition) Swap(i, j int) {
+	p.docIDs[i], p.docIDs[j] = p.docIDs[j], p.docIDs[i]
+	p.positions[i], p.positions[j] = p.positions[j], p.positions[i]
+}
+
+// coveringCandidates returns, in ascending order, the internal IDs of documents whose
+// posting list hits, plus the number of pruned trigrams, account for at least the given
+// fraction of the trigrams
+func (svc *Service) coveringCandidates(tGrams []trigram.T, min float64) []trigram.DocID {
+	need := min * float64(len(tGrams))
+	var pruned int
+	hits := make(map[trigram.DocID]int)
+	for _, t := range tGrams {
+		posting, ok := svc.idx.Posting(t)
+		if ok && posting == nil {
+			pruned++
+			continue
+		}
+		for _, docID := range posting {
+			hits[docID]++
+		}
+	}
+	if float64(pruned) >= need {
+		return svc.liveDocIDs()
+	}
+	docIDs := make([]trigram.DocID, 0, len(hits))
+	for docID, n := range hits {
+		if float64(n+pruned) >= need {
+			docIDs = append(docIDs, docID)
+		}
+	}
+	sort.Slice(docIDs, func(i, j int) bool { return docIDs[i] < docIDs[j] })
+	return docIDs
+}
+
+// covers reports whether the words present in the document account for at least the
+// given fraction of total query trigrams, counting each word's trigrams as analyzeQuery
+// extracted them for the anchor
+func (m meta) covers(words []string, anchor Anchor, total int, min float64) bool {
+	var covered []trigram.T
+	for _, word := range words {
+		if m.sa.Lookup([]byte(word), 1) == nil {
+			continue
+		}
+		word = strings.Trim(word, saDelim)
+		if anchor == AnchorSuffix {
+			word = suffixForm(word)
+		}
+		covered = trigram.Extract(word, covered)
+	}
+	return float64(len(covered)) >= min*float64(total)
+}
+
+// inOrder reports whether the words occur in the document in the given order, comparing
+// the byte offsets at which each word occurs in the document's suffix array
+func (m meta) inOrder(words []string) bool {
+	pos := -1
+	for _, word := range words {
+		next := -1
+		for _, offset := range m.sa.Lookup([]byte(word), -1) {
+			if offset > pos && (next < 0 || offset < next) {
+				next = offset
+			}
+		}
+		if next < 0 {
+			return false
+		}
+		pos = next
+	}
+	return true
+}
+
+// tooBroad reports whether a query with the given trigram candidates exceeds the
+// Service's maximum query breadth.  Retired internal IDs, which the trigram index
+// returns for fully pruned queries, are not counted.  The caller must hold the lock.
+func (svc *Service) tooBroad(candidates []trigram.DocID) bool {
+	if svc.maxQueryBreadth <= 0 {
+		return false
+	}
+	limit := svc.maxQueryBreadth * float64(len(svc.docs))
+	if float64(len(candidates)) <= limit {
+		return false
+	}
+	var live int
+	for _, docID := range candidates {
+		if _, ok := svc.docs[docID]; ok {
+			live++
+		}
+	}
+	return float64(live) > limit
+}
+
+// EstimateMatches returns the number of documents the trigram index reports as
+// candidates for query, without verifying them against their suffix arrays.  It is
+// cheap compared to Search and never smaller than the number of documents Search
+// would return, but trigram false positives make it an overestimate, and when every
+// query trigram has been pruned as too common it counts every internal ID ever
+// assigned, including those of deleted and updated documents.
+// Callers can use it to warn that a query is too broad before running it.
+func (svc *Service) EstimateMatches(ctx context.Context, query string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	q, err := svc.newQuery(query, SearchOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer q.release()
+	svc.RLock()
+	defer svc.RUnlock()
+	return len(svc.queryCandidates(q)), nil
+}
+
+// SearchCounts performs the same search as Search, but returns the number of times the
+// query words matched in each document, keyed by external ID, for ranking documents by
+// term frequency.  Every occurrence of every query word is counted, including
+// occurrences that only match a query word by prefix and occurrences of synonyms, so
+// SearchCounts is more expensive than Search, which stops at the first occurrence.
+func (svc *Service) SearchCounts(ctx context.Context, query string) (map[uint64]int, error) {
+	if err := svc.acquireSearch(); err != nil {
+		return nil, err
+	}
+	defer svc.releaseSearch()
+	q, err := svc.newQuery(query, SearchOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer q.release()
+	svc.RLock()
+	defer svc.RUnlock()
+	counts := make(map[uint64]int)
+	err = svc.verify(ctx, svc.queryCandidates(q), q.matches, func(_ trigram.DocID, doc meta) bool {
+		counts[doc.id] = q.hits(doc)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// DocResult is a matching document and the text it was indexed with
+type DocResult struct {
+	ID   uint64 // external ID of the document
+	Text string // the text passed to Upsert, or its truncation under WithMaxDocBytes
+}
+
+// SearchDocs performs the same search as Search, but returns the text of each matching
+// document along with its ID so that results can be rendered without a second lookup.
+// The text is exactly as it was passed to Upsert, before tokenization, transliteration
+// or lowercasing.
+func (svc *Service) SearchDocs(ctx context.Context, query string) ([]DocResult, error) {
+	if err := svc.acquireSearch(); err != nil {
+		return nil, err
+	}
+	defer svc.releaseSearch()
+	q, err := svc.newQuery(query, SearchOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer q.release()
+	svc.RLock()
+	defer svc.RUnlock()
+	candidates := svc.queryCandidates(q)
+	results := make([]DocResult, 0, len(candidates))
+	err = svc.verify(ctx, candidates, q.matches, func(_ trigram.DocID, doc meta) bool {
+		results = append(results, DocResult{ID: doc.id, Text: doc.text})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// SearchScoped performs the same search as Search, but only considers documents whose
+// external ID is in scope, such as the documents a user is permitted to see.  Candidates
+// outside scope are skipped before they are verified against their suffix arrays, so
+// a small scope makes the search cheaper than filtering the results of Search.
+func (svc *Service) SearchScoped(ctx context.Context, query string, scope map[uint64]struct{}) ([]uint64, error) {
+	if err := svc.acquireSearch(); err != nil {
+		return nil, err
+	}
+	defer svc.releaseSearch()
+	q, err := svc.newQuery(query, SearchOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer q.release()
+	svc.RLock()
+	defer svc.RUnlock()
+	// drop candidates outside scope before their suffix arrays are readied
+	var scoped []trigram.DocID
+	for _, docID := range svc.queryCandidates(q) {
+		if doc, ok := svc.docs[docID]; ok {
+			if _, ok := scope[doc.id]; ok {
+				scoped = append(scoped, docID)
+			}
+		}
+	}
+	docIDs := make([]uint64, 0, len(scoped))
+	err = svc.verify(ctx, scoped, q.matches, func(_ trigram.DocID, doc meta) bool {
+		docIDs = append(docIDs, doc.id)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return docIDs, nil
+}
+
+// SearchIntersect returns the documents matching every one of the queries, each analyzed
+// and matched as if passed to Search on its own, in the order they were indexed.  The
+// result equals the intersection of the queries' Search results, but candidates are
+// intersected before any are verified, so it is much cheaper than running the queries
+// separately.  It suits faceted search, where each query is a separate filter.
+func (svc *Service) SearchIntersect(ctx context.Context, queries []string) ([]uint64, error) {
+	if err := svc.acquireSearch(); err != nil {
+		return nil, err
+	}
+	defer svc.releaseSearch()
+	if len(queries) == 0 {
+		return nil, fmt.Errorf(`at least one query is required`)
+	}
+	qs := make([]*searchQuery, 0, len(queries))
+	defer func() {
+		for _, q := range qs {
+			q.release()
+		}
+	}()
+	for i, query := range queries {
+		q, err := svc.newQuery(query, SearchOptions{})
+		if err != nil {
+			return nil, fmt.Errorf(`queries[%d]: %w`, i, err)
+		}
+		qs = append(qs, q)
+	}
+	svc.RLock()
+	defer svc.RUnlock()
+	var candidates []trigram.DocID
+	for i, q := range qs {
+		if i == 0 {
+			candidates = svc.queryCandidates(q)
+		} else {
+			candidates = intersectDocIDs(candidates, svc.queryCandidates(q))
+		}
+	}
+	docIDs := make([]uint64, 0, len(candidates))
+	err := svc.verify(ctx, candidates, matchesAll(qs), func(_ trigram.DocID, doc meta) bool {
+		docIDs = append(docIDs, doc.id)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return docIDs, nil
+}
+
+// matchesAll returns a function reporting whether a document satisfies every one of qs
+func matchesAll(qs []*searchQuery) func(doc meta) bool {
+	return func(doc meta) bool {
+		for _, q := range qs {
+			if !q.matches(doc) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// SearchExcludingAll returns, in the order Search would return them, the external IDs of
+// the documents that match none of terms, each of which is analyzed and matched like a
+// Search query, so a document is excluded if it matches any one of them.  Matches of
+// each term are found through the trigram index as usual, but the result is their
+// complement, which can only be produced by enumerating every document in the index.
+// SearchExcludingAll is therefore meant for negative filtering in reports and batch
+// jobs, not for typeahead.  ctx is checked between documents.
+func (svc *Service) SearchExcludingAll(ctx context.Context, terms []string) ([]uint64, error) {
+	if err := svc.acquireSearch(); err != nil {
+		return nil, err
+	}
+	defer svc.releaseSearch()
+	if len(terms) == 0 {
+		return nil, fmt.Errorf(`at least one term is required`)
+	}
+	qs := make([]*searchQuery, 0, len(terms))
+	defer func() {
+		for _, q := range qs {
+			q.release()
+		}
+	}()
+	for i, term := range terms {
+		q, err := svc.newQuery(term, SearchOptions{})
+		if err != nil {
+			return nil, fmt.Errorf(`terms[%d]: %w`, i, err)
+		}
+		qs = append(qs, q)
+	}
+	svc.RLock()
+	defer svc.RUnlock()
+	excluded := make(map[trigram.DocID]bool)
+	for _, q := range qs {
+		var remaining []trigram.DocID
+		for _, docID := range svc.queryCandidates(q) {
+			if !excluded[docID] {
+				remaining = append(remaining, docID)
+			}
+		}
+		err := svc.verify(ctx, remaining, q.matches, func(docID trigram.DocID, _ meta) bool {
+			excluded[docID] = true
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	docIDs := make([]uint64, 0, len(svc.docs)-len(excluded))
+	for _, docID := range svc.liveDocIDs() {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		if !excluded[docID] {
+			docIDs = append(docIDs, svc.docs[docID].id)
+		}
+	}
+	return docIDs, nil
+}
+
+// SearchTerms performs the same search as Search for a query the caller has already
+// tokenized: each of terms is matched as one word, by prefix, exactly as given.  Search
+// passes the query through the Service's normalizer and Tokenizer, which may split a
+// term such as "well-known" or "e-mail" into several words; SearchTerms never re-splits
+// or normalizes a term, so a term only matches documents whose Tokenizer kept it whole,
+// and terms should be lowercased as the Tokenizer would lowercase them.  Empty terms and
+// terms consisting only of whitespace are ignored.  Synonyms apply, but
+// WithMinQueryWordLength and WithMaxQueryBreadth do not.
+func (svc *Service) SearchTerms(ctx context.Context, terms []string) ([]uint64, error) {
+	if err := svc.acquireSearch(); err != nil {
+		return nil, err
+	}
+	defer svc.releaseSearch()
+	q, err := svc.newTermsQuery(terms)
+	if err != nil {
+		return nil, err
+	}
+	defer q.release()
+	docIDs, _, err := svc.search(ctx, q)
+	return docIDs, err
+}
+
+// SearchSorted performs the same search as Search, returning the results sorted by less,
+// which reports whether the document with external ID a belongs before the one with
+// external ID b.  The sort is stable, so results less considers equal keep the order
+// Search returns them in.  less is called after the index has been unlocked, so it may
+// consult data of its own, or even the Service, without blocking writers.
+func (svc *Service) SearchSorted(ctx context.Context, query string, less func(a, b uint64) bool) ([]uint64, error) {
+	if less == nil {
+		return nil, fmt.Errorf(`a comparator is required`)
+	}
+	docIDs, err := svc.Search(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(docIDs, func(i, j int) bool { return less(docIDs[i], docIDs[j]) })
+	return docIDs, nil
+}
+
+// SearchTrigrams returns, in the order they were indexed, the external IDs of the
+// documents listed under every one of tGrams whose suffix arrays contain every one of
+// verifyWords, looked up exactly as indexed.  With no verifyWords, every candidate is
+// returned unverified.  Synonyms and WithMaxQueryBreadth do not apply.
+func (svc *Service) SearchTrigrams(ctx context.Context, tGrams []trigram.T, verifyWords []string) ([]uint64, error) {
+	if err := svc.acquireSearch(); err != nil {
+		return nil, err
+	}
+	defer svc.releaseSearch()
+	if len(tGrams) == 0 {
+		return nil, fmt.Errorf(`at least one trigram is required`)
+	}
+	// the trigram index reorders the trigrams it is given
+	tGrams = slices.Clone(tGrams)
+	svc.RLock()
+	defer svc.RUnlock()
+	candidates := svc.idx.QueryTrigrams(tGrams)
+	docIDs := make([]uint64, 0, len(candidates))
+	match := func(doc meta) bool { return doc.contains(verifyWords) }
+	err := svc.verify(ctx, candidates, match, func(_ trigram.DocID, doc meta) bool {
+		docIDs = append(docIDs, doc.id)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return docIDs, nil
+}
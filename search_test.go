@@ -0,0 +1,1236 @@
+package fulltext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dgryski/go-trigram"
+)
+
+func TestService_SearchWith_anchor(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		query   string
+		anchor  Anchor
+		want    []uint64
+		wantErr bool
+	}{
+		{
+			name:   "AnchorWhole matches the whole word 'sea'",
+			query:  "sea",
+			anchor: AnchorWhole,
+			want:   []uint64{docTwo.ID, docThree.ID},
+		},
+		{
+			name:   "AnchorWhole does not match 'shell' as a prefix of 'shells'",
+			query:  "shell",
+			anchor: AnchorWhole,
+			want:   []uint64{},
+		},
+		{
+			name:   "AnchorWhole does not match 'se' as a prefix of 'sea'",
+			query:  "se",
+			anchor: AnchorWhole,
+			want:   []uint64{},
+		},
+		{
+			name:   "AnchorPrefix matches 'se' as a prefix of 'sea' and 'sells'",
+			query:  "se",
+			anchor: AnchorPrefix,
+			want:   []uint64{docTwo.ID, docThree.ID},
+		},
+		{
+			name:   "AnchorContains matches 'row' within 'brown'",
+			query:  "row",
+			anchor: AnchorContains,
+			want:   []uint64{docOne.ID},
+		},
+		{
+			name:   "AnchorContains still filters trigram false positives",
+			query:  "ickpep",
+			anchor: AnchorContains,
+			want:   []uint64{},
+		},
+		{
+			name:    "AnchorContains requires at least one trigram",
+			query:   "ro",
+			anchor:  AnchorContains,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := svc.SearchWith(ctx, tt.query, SearchOptions{Anchor: tt.anchor})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Service.SearchWith() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.SearchWith() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_SearchWith_maxCandidates(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	var docs []Doc
+	for id := uint64(1); id <= 50; id++ {
+		docs = append(docs, Doc{ID: id, Text: fmt.Sprintf("pickled peppers batch %d", id)})
+	}
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		maxCandidates int
+		wantLen       int
+		wantPartial   bool
+	}{
+		{name: "unlimited", maxCandidates: 0, wantLen: 50},
+		{name: "cap above candidate count", maxCandidates: 100, wantLen: 50},
+		{name: "cap equal to candidate count", maxCandidates: 50, wantLen: 50},
+		{name: "cap truncates", maxCandidates: 10, wantLen: 10, wantPartial: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, partial, err := svc.SearchWith(ctx, "pickled pep", SearchOptions{MaxCandidates: tt.maxCandidates})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != tt.wantLen {
+				t.Errorf("Service.SearchWith() returned %d results, want %d", len(got), tt.wantLen)
+			}
+			if partial != tt.wantPartial {
+				t.Errorf("Service.SearchWith() partial = %v, want %v", partial, tt.wantPartial)
+			}
+		})
+	}
+}
+
+// skewedCorpus returns a corpus in which "alpha" is common enough to be pruned, "bravo"
+// is rare, and many documents contain every trigram of "bravo" without containing the word
+func skewedCorpus() []Doc {
+	docs := make([]Doc, 0, 1000)
+	for id := uint64(1); id <= 1000; id++ {
+		var text string
+		switch {
+		case id <= 10:
+			text = fmt.Sprintf("alpha bravo filler%d", id)
+		case id <= 90:
+			text = fmt.Sprintf("alpha bravado avocado filler%d", id)
+		case id <= 290:
+			text = fmt.Sprintf("alpha filler%d", id)
+		default:
+			text = fmt.Sprintf("filler%d", id)
+		}
+		docs = append(docs, Doc{ID: id, Text: text})
+	}
+	return docs
+}
+
+func BenchmarkService_verify_skewed(b *testing.B) {
+	svc := NewService()
+	if err := svc.Upsert(context.TODO(), skewedCorpus()); err != nil {
+		b.Fatal(err)
+	}
+	tGrams, words := svc.analyzeQuery("alpha bravo", SearchOptions{}, nil)
+	candidates := svc.idx.QueryTrigrams(tGrams)
+	benchmarks := []struct {
+		name  string
+		words []string
+	}{
+		{name: "query-order", words: words},
+		{name: "rarest-first", words: svc.plan(append([]string(nil), words...))},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			var lookups int
+			for i := 0; i < b.N; i++ {
+				for _, docID := range candidates {
+					for _, word := range bm.words {
+						lookups++
+						if svc.docs[docID].sa.Lookup([]byte(word), 1) == nil {
+							break
+						}
+					}
+				}
+			}
+			b.ReportMetric(float64(lookups)/float64(b.N), "lookups/op")
+		})
+	}
+}
+
+func BenchmarkService_Search_skewed(b *testing.B) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, skewedCorpus()); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := svc.Search(ctx, "alpha bravo"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkService_Search_allocs(b *testing.B) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, skewedCorpus()); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := svc.Search(ctx, "bravo avocado"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkService_Search_singleTerm(b *testing.B) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, skewedCorpus()); err != nil {
+		b.Fatal(err)
+	}
+	for _, bm := range []struct {
+		name string
+		fast bool
+	}{{name: "general", fast: false}, {name: "fast-path", fast: true}} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				q, err := svc.newQuery("bravado", SearchOptions{})
+				if err != nil {
+					b.Fatal(err)
+				}
+				if !bm.fast {
+					q.term = nil
+				}
+				if _, _, err := svc.search(ctx, q); err != nil {
+					b.Fatal(err)
+				}
+				q.release()
+			}
+		})
+	}
+}
+
+func TestService_Search_singleTerm(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService(WithSynonyms(map[string][]string{"sea": {"ocean"}}))
+	// long enough that the fast path looks the word up rather than scanning for it
+	long := Doc{ID: 4000, Text: strings.Repeat("pickled ", 40) + "bravo"}
+	if err := svc.Upsert(ctx, append(skewedCorpus(), docOne, Doc{ID: 2000, Text: docTwo.Text}, Doc{ID: 3000, Text: docThree.Text}, long)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query    string
+		opts     SearchOptions
+		wantFast bool
+	}{
+		{query: "bravo", wantFast: true},
+		{query: "alpha", wantFast: true},
+		{query: "pick", wantFast: true},
+		{query: "zebra", wantFast: true},
+		{query: "brown", opts: SearchOptions{Anchor: AnchorWhole}, wantFast: true},
+		{query: "sea", wantFast: false},
+		{query: "alpha bravo", wantFast: false},
+		{query: "bravo", opts: SearchOptions{Ordered: true}, wantFast: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			run := func(fast bool) []uint64 {
+				q, err := svc.newQuery(tt.query, tt.opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer q.release()
+				if (q.term != nil) != tt.wantFast {
+					t.Fatalf("fast path = %v, want %v", q.term != nil, tt.wantFast)
+				}
+				if !fast {
+					q.term = nil
+				}
+				got, _, err := svc.search(ctx, q)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return got
+			}
+			if fast, general := run(true), run(false); !reflect.DeepEqual(fast, general) {
+				t.Errorf("fast path returned %v, general path %v", fast, general)
+			}
+		})
+	}
+}
+
+func TestService_plan(t *testing.T) {
+	svc := NewService()
+	if err := svc.Upsert(context.TODO(), skewedCorpus()); err != nil {
+		t.Fatal(err)
+	}
+	_, words := svc.analyzeQuery("alpha bravo", SearchOptions{}, nil)
+	want := []string{"_bravo", "_alpha"}
+	if got := svc.plan(words); !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.plan() = %q, want %q", got, want)
+	}
+	got, err := svc.Search(context.TODO(), "alpha bravo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 10 {
+		t.Errorf("Service.Search() returned %d results, want %d", len(got), 10)
+	}
+}
+
+func TestService_SearchWith_ordered(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		query   string
+		ordered bool
+		want    []uint64
+	}{
+		{
+			name:    "A before B matches",
+			query:   "peter peppers",
+			ordered: true,
+			want:    []uint64{docThree.ID},
+		},
+		{
+			name:    "B before A does not match",
+			query:   "peppers peter",
+			ordered: true,
+			want:    []uint64{},
+		},
+		{
+			name:    "B before A matches without Ordered",
+			query:   "peppers peter",
+			ordered: false,
+			want:    []uint64{docThree.ID},
+		},
+		{
+			name:    "terms need not be adjacent",
+			query:   "sells shore",
+			ordered: true,
+			want:    []uint64{docTwo.ID},
+		},
+		{
+			name:    "a repeated word must occur repeatedly",
+			query:   "sea sea",
+			ordered: true,
+			want:    []uint64{docTwo.ID},
+		},
+		{
+			name:    "later occurrences satisfy the order",
+			query:   "shells sea",
+			ordered: true,
+			want:    []uint64{docTwo.ID},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := svc.SearchWith(ctx, tt.query, SearchOptions{Ordered: tt.ordered})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.SearchWith() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_SearchWith_order(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	// index out of ID order so that insertion order differs from ID order
+	if err := svc.Upsert(ctx, []Doc{docThree, docOne, docTwo}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		query string
+		order Order
+		want  []uint64
+	}{
+		{name: "OrderNone keeps insertion order", query: "the", order: OrderNone, want: []uint64{docThree.ID, docOne.ID, docTwo.ID}},
+		{name: "OrderIDAsc", query: "the", order: OrderIDAsc, want: []uint64{docOne.ID, docTwo.ID, docThree.ID}},
+		{name: "OrderIDDesc", query: "the", order: OrderIDDesc, want: []uint64{docThree.ID, docTwo.ID, docOne.ID}},
+		{name: "OrderIDAsc of a subset", query: "jump", order: OrderIDAsc, want: []uint64{docOne.ID, docThree.ID}},
+		{name: "OrderIDDesc of a subset", query: "jump", order: OrderIDDesc, want: []uint64{docThree.ID, docOne.ID}},
+		{name: "OrderPosition puts a match at the start first", query: "the", order: OrderPosition, want: []uint64{docOne.ID, docTwo.ID, docThree.ID}},
+		{name: "OrderPosition of a subset", query: "sea", order: OrderPosition, want: []uint64{docTwo.ID, docThree.ID}},
+		{name: "OrderPosition uses the earliest query word", query: "shells pickled", order: OrderPosition, want: []uint64{docThree.ID}},
+		{name: "OrderPosition is not insertion order", query: "jump", order: OrderPosition, want: []uint64{docOne.ID, docThree.ID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := svc.SearchWith(ctx, tt.query, SearchOptions{Order: tt.order})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.SearchWith() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_SearchWith_minTrigramCoverage(t *testing.T) {
+	ctx := context.TODO()
+	tests := []struct {
+		name     string
+		query    string
+		coverage float64
+		want     []uint64
+	}{
+		{name: "default requires every word", query: "shells zx", coverage: 0, want: []uint64{}},
+		{name: "full coverage requires every word", query: "shells zx", coverage: 1, want: []uint64{}},
+		{name: "0.9 rejects 'shells' alone (5/6)", query: "shells zx", coverage: 0.9, want: []uint64{}},
+		{name: "0.8 accepts 'shells' alone (5/6)", query: "shells zx", coverage: 0.8, want: []uint64{docTwo.ID, docThree.ID}},
+		{name: "0.5 rejects 'fox' alone (2/6)", query: "fox shore", coverage: 0.5, want: []uint64{docTwo.ID}},
+		{name: "0.25 accepts 'fox' alone (2/6)", query: "fox shore", coverage: 0.25, want: []uint64{docOne.ID, docTwo.ID}},
+		{name: "full matches are unaffected", query: "she shore", coverage: 0.5, want: []uint64{docTwo.ID}},
+	}
+	// run against a small corpus, where every trigram is pruned, and a larger one, where
+	// candidates come from posting list hit counts
+	var filler []Doc
+	for id := uint64(100); id < 150; id++ {
+		filler = append(filler, Doc{ID: id, Text: fmt.Sprintf("filler%d", id)})
+	}
+	corpora := map[string][]Doc{
+		"pruned":   {docOne, docTwo, docThree},
+		"unpruned": append([]Doc{docOne, docTwo, docThree}, filler...),
+	}
+	for name, docs := range corpora {
+		svc := NewService()
+		if err := svc.Upsert(ctx, docs); err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				got, _, err := svc.SearchWith(ctx, tt.query, SearchOptions{MinTrigramCoverage: tt.coverage})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Service.SearchWith() = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestService_SearchWith_suffix(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService(WithSuffixIndex())
+	docs := []Doc{
+		{ID: 1, Text: "quarterly report 2024.pdf"},
+		{ID: 2, Text: "portable charger"},
+		{ID: 3, Text: "annual export 2023.csv"},
+	}
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		query string
+		want  []uint64
+	}{
+		{
+			name:  "'port' matches the end of 'report' and 'export' but not 'portable'",
+			query: "port",
+			want:  []uint64{1, 3},
+		},
+		{
+			name:  "'2024.pdf' matches each word by its ending",
+			query: "024.pdf",
+			want:  []uint64{1},
+		},
+		{
+			name:  "'charge' is a prefix but not a suffix of 'charger'",
+			query: "charge",
+			want:  []uint64{},
+		},
+		{
+			name:  "a whole word is also its own suffix",
+			query: "charger",
+			want:  []uint64{2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := svc.SearchWith(ctx, tt.query, SearchOptions{Anchor: AnchorSuffix})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.SearchWith(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+	// coverage counts the suffix form trigrams generated for each word
+	got, _, err := svc.SearchWith(ctx, "port zzz", SearchOptions{Anchor: AnchorSuffix, MinTrigramCoverage: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{1, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.SearchWith() with MinTrigramCoverage = %v, want %v", got, want)
+	}
+	got, _, err = svc.SearchWith(ctx, "charger", SearchOptions{Anchor: AnchorSuffix, MinTrigramCoverage: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.SearchWith() with MinTrigramCoverage = %v, want %v", got, want)
+	}
+	if err := svc.Delete(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	svc.Reindex()
+	if err := svc.Validate(); err != nil {
+		t.Errorf("Service.Validate() = %v after delete and reindex", err)
+	}
+	if _, _, err := NewService().SearchWith(ctx, "port", SearchOptions{Anchor: AnchorSuffix}); err == nil {
+		t.Error("Service.SearchWith() with AnchorSuffix should fail without WithSuffixIndex")
+	}
+}
+
+func TestService_Search_substringMatching(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService(WithSubstringMatching())
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		query  string
+		anchor Anchor
+		want   []uint64
+	}{
+		{
+			name:  "'row' matches within 'brown'",
+			query: "row",
+			want:  []uint64{1},
+		},
+		{
+			name:  "'ells' matches within 'sells' and 'shells'",
+			query: "ells",
+			want:  []uint64{2, 3},
+		},
+		{
+			name:  "prefixes still match",
+			query: "pick pep",
+			want:  []uint64{3},
+		},
+		{
+			name:   "AnchorWhole still requires whole words",
+			query:  "sea",
+			anchor: AnchorWhole,
+			want:   []uint64{2, 3},
+		},
+		{
+			name:   "'row' is not a whole word",
+			query:  "row",
+			anchor: AnchorWhole,
+			want:   []uint64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := svc.SearchWith(ctx, tt.query, SearchOptions{Anchor: tt.anchor})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.SearchWith(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+	if err := svc.Validate(); err != nil {
+		t.Errorf("Service.Validate() = %v", err)
+	}
+	if err := svc.Merge(NewService()); err == nil {
+		t.Error("Service.Merge() should fail when only one Service uses WithSubstringMatching")
+	}
+}
+
+func TestService_EstimateMatches(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, skewedCorpus()); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		query        string
+		want         int
+		wantVerified int
+	}{
+		{
+			name:         "exact when the trigrams identify the word",
+			query:        "avocado",
+			want:         80,
+			wantVerified: 80,
+		},
+		{
+			name:         "overestimates when 'bravado' shares every trigram of 'bravo'",
+			query:        "bravo",
+			want:         90,
+			wantVerified: 10,
+		},
+		{
+			name:         "counts every document when all trigrams are pruned",
+			query:        "alpha",
+			want:         1000,
+			wantVerified: 290,
+		},
+		{
+			name:         "zero when a trigram is absent",
+			query:        "zebra",
+			want:         0,
+			wantVerified: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.EstimateMatches(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Service.EstimateMatches(%q) = %d, want %d", tt.query, got, tt.want)
+			}
+			verified, err := svc.Search(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(verified) != tt.wantVerified {
+				t.Errorf("Service.Search(%q) returned %d documents, want %d", tt.query, len(verified), tt.wantVerified)
+			}
+		})
+	}
+	if _, err := svc.EstimateMatches(ctx, "a"); err == nil {
+		t.Error("Service.EstimateMatches() should reject a query without enough content")
+	}
+}
+
+func TestService_SearchCounts(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query string
+		want  map[uint64]int
+	}{
+		{query: "sea", want: map[uint64]int{docTwo.ID: 2, docThree.ID: 1}},
+		{query: "sea shells", want: map[uint64]int{docTwo.ID: 3, docThree.ID: 2}},
+		{query: "pe", want: map[uint64]int{docThree.ID: 3}},
+		{query: "zebra", want: map[uint64]int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := svc.SearchCounts(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.SearchCounts(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_Search_minQueryWordLength(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService(WithMinQueryWordLength(3))
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		query string
+		want  []uint64
+	}{
+		{
+			name:  "the short word 'x' is ignored",
+			query: "x peck",
+			want:  []uint64{docThree.ID},
+		},
+		{
+			name:  "short words are ignored wherever they appear",
+			query: "quick b fo",
+			want:  []uint64{docOne.ID},
+		},
+		{
+			name:  "a query of only short words is searched as typed",
+			query: "se",
+			want:  []uint64{docTwo.ID, docThree.ID},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.Search(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_SearchDocs(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	accented := Doc{ID: 4, Text: "Crème Brûlée, served *chilled*"}
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree, accented}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query string
+		want  []DocResult
+	}{
+		{query: "sea", want: []DocResult{{ID: docTwo.ID, Text: docTwo.Text}, {ID: docThree.ID, Text: docThree.Text}}},
+		{query: "chilled", want: []DocResult{{ID: accented.ID, Text: accented.Text}}},
+		{query: "zebra", want: []DocResult{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := svc.SearchDocs(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.SearchDocs(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_SearchScoped(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	docs := []Doc{
+		{ID: 1, Text: "pickled peppers"},
+		{ID: 2, Text: "pickled onions"},
+		{ID: 3, Text: "pickled herring"},
+		{ID: 4, Text: "fresh peppers"},
+	}
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		query string
+		scope map[uint64]struct{}
+		want  []uint64
+	}{
+		{
+			name:  "two of three matches are in scope",
+			query: "pickled",
+			scope: map[uint64]struct{}{1: {}, 3: {}, 4: {}},
+			want:  []uint64{1, 3},
+		},
+		{
+			name:  "documents in scope must still match",
+			query: "pickled pep",
+			scope: map[uint64]struct{}{1: {}, 3: {}, 4: {}},
+			want:  []uint64{1},
+		},
+		{
+			name:  "IDs in scope that are not indexed are ignored",
+			query: "pickled",
+			scope: map[uint64]struct{}{2: {}, 99: {}},
+			want:  []uint64{2},
+		},
+		{
+			name:  "an empty scope matches nothing",
+			query: "pickled",
+			scope: map[uint64]struct{}{},
+			want:  []uint64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.SearchScoped(ctx, tt.query, tt.scope)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.SearchScoped(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_SearchIntersect(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		queries []string
+		want    []uint64
+	}{
+		{
+			name:    "both queries match docTwo and docThree",
+			queries: []string{"sea", "shells"},
+			want:    []uint64{2, 3},
+		},
+		{
+			name:    "each query narrows the result",
+			queries: []string{"sea", "shells", "pick"},
+			want:    []uint64{3},
+		},
+		{
+			name:    "a single query behaves like Search",
+			queries: []string{"the"},
+			want:    []uint64{1, 2, 3},
+		},
+		{
+			name:    "disjoint queries",
+			queries: []string{"fox", "shore"},
+			want:    []uint64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.SearchIntersect(ctx, tt.queries)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.SearchIntersect(%q) = %v, want %v", tt.queries, got, tt.want)
+			}
+		})
+	}
+	if _, err := svc.SearchIntersect(ctx, nil); err == nil {
+		t.Error("Service.SearchIntersect() should reject an empty list of queries")
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := svc.SearchIntersect(cancelled, []string{"sea", "shells"}); err != context.Canceled {
+		t.Errorf("Service.SearchIntersect() error = %v with a cancelled context, want %v", err, context.Canceled)
+	}
+}
+
+func TestService_Search_maxQueryBreadth(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService(WithMaxQueryBreadth(0.5))
+	if err := svc.Upsert(ctx, skewedCorpus()); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query   string
+		wantErr error
+	}{
+		{query: "fill", wantErr: ErrQueryTooBroad},
+		// only 290 documents contain "alpha", but its trigrams have all been pruned
+		{query: "alpha", wantErr: ErrQueryTooBroad},
+		{query: "bravado"},
+		{query: "fill brav"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := svc.Search(ctx, tt.query)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Service.Search() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	if _, err := NewService().Search(ctx, "fill"); err != nil {
+		t.Errorf("Service.Search() error = %v without WithMaxQueryBreadth", err)
+	}
+	// deletes and updates leave retired internal IDs behind, which a query whose trigrams
+	// have all been pruned still gets back as candidates
+	retired := NewService(WithMaxQueryBreadth(1))
+	var docs []Doc
+	for id := uint64(1); id <= 20; id++ {
+		docs = append(docs, Doc{ID: id, Text: docThree.Text})
+	}
+	if err := retired.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	if err := retired.Delete(ctx, 20); err != nil {
+		t.Fatal(err)
+	}
+	if err := retired.Upsert(ctx, []Doc{{ID: 1, Text: docThree.Text, PriorText: docThree.Text}}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := retired.Search(ctx, "peppers")
+	if err != nil {
+		t.Fatalf("Service.Search() error = %v with retired internal IDs", err)
+	}
+	if len(got) != 19 {
+		t.Errorf("Service.Search() returned %d documents, want %d", len(got), 19)
+	}
+}
+
+func TestService_SearchWith_partialLastWord(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	opts := SearchOptions{PartialLastWord: true}
+	// every prefix of the query as it is typed matches docThree
+	typed := "pickled pepp"
+	for i := len("pi"); i <= len(typed); i++ {
+		got, _, err := svc.SearchWith(ctx, typed[:i], opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []uint64{docThree.ID}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Service.SearchWith(%q) = %v, want %v", typed[:i], got, want)
+		}
+	}
+	tests := []struct {
+		query  string
+		want   []uint64
+		strict []uint64
+	}{
+		{query: "pickled pepx", want: []uint64{3}, strict: []uint64{}},
+		{query: "sea shx", want: []uint64{2, 3}, strict: []uint64{}},
+		{query: "pepx pickled", want: []uint64{}, strict: []uint64{}},
+		{query: "quick pep", want: []uint64{}, strict: []uint64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, _, err := svc.SearchWith(ctx, tt.query, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.SearchWith(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+			if got, err = svc.Search(ctx, tt.query); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.strict) {
+				t.Errorf("Service.Search(%q) = %v, want %v", tt.query, got, tt.strict)
+			}
+		})
+	}
+}
+
+func TestService_SearchTrigrams(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		tGrams []trigram.T
+		words  []string
+		want   []uint64
+	}{
+		{
+			name:   "trigrams and words of an anchored prefix",
+			tGrams: trigram.Extract("_shel", nil),
+			words:  []string{"_shel"},
+			want:   []uint64{2, 3},
+		},
+		{
+			name:   "a whole word",
+			tGrams: trigram.Extract("_sea", nil),
+			words:  []string{"_sea\x00"},
+			want:   []uint64{2, 3},
+		},
+		{
+			name:   "a substring the analyzer would anchor",
+			tGrams: trigram.Extract("ump", nil),
+			words:  []string{"ump"},
+			want:   []uint64{1, 3},
+		},
+		{
+			name:   "unverified candidates include every document when the trigrams are pruned",
+			tGrams: trigram.Extract("ump", nil),
+			want:   []uint64{1, 2, 3},
+		},
+		{
+			name:   "words the trigrams do not account for",
+			tGrams: trigram.Extract("_pick", nil),
+			words:  []string{"_pick", "_fox"},
+			want:   []uint64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.SearchTrigrams(ctx, tt.tGrams, tt.words)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.SearchTrigrams() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := svc.SearchTrigrams(ctx, nil, []string{"_sea"}); err == nil {
+		t.Error("Service.SearchTrigrams() should reject an empty list of trigrams")
+	}
+}
+
+func TestService_maxConcurrentSearches(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService(WithMaxConcurrentSearches(2))
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	// unread streams hold their search slots until cancelled
+	streamCtx, cancel := context.WithCancel(ctx)
+	var errcs []<-chan error
+	for i := 0; i < 2; i++ {
+		_, errc := svc.SearchStream(streamCtx, "sea shells")
+		errcs = append(errcs, errc)
+	}
+	if _, err := svc.Search(ctx, "fox"); !errors.Is(err, ErrBusy) {
+		t.Errorf("Service.Search() with every slot in use: err = %v, want ErrBusy", err)
+	}
+	if _, err := svc.SimilarTo(ctx, docOne.ID, 1); !errors.Is(err, ErrBusy) {
+		t.Errorf("Service.SimilarTo() with every slot in use: err = %v, want ErrBusy", err)
+	}
+	_, errc := svc.SearchStream(ctx, "fox")
+	if err := <-errc; !errors.Is(err, ErrBusy) {
+		t.Errorf("Service.SearchStream() with every slot in use: err = %v, want ErrBusy", err)
+	}
+	if _, err := svc.EstimateMatches(ctx, "fox"); err != nil {
+		t.Errorf("Service.EstimateMatches() with every slot in use: %v", err)
+	}
+	cancel()
+	for _, errc := range errcs {
+		for range errc {
+		}
+	}
+	got, err := svc.Search(ctx, "fox")
+	if err != nil {
+		t.Fatalf("Service.Search() after slots were released: %v", err)
+	}
+	if want := []uint64{docOne.ID}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.Search() = %v, want %v", got, want)
+	}
+}
+
+func TestService_SearchSorted(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	descending := func(a, b uint64) bool { return a > b }
+	// documents mentioning the sea first, otherwise in the order Search returns them
+	sea := map[uint64]bool{docTwo.ID: true, docThree.ID: true}
+	seaFirst := func(a, b uint64) bool { return sea[a] && !sea[b] }
+	tests := []struct {
+		name    string
+		query   string
+		less    func(a, b uint64) bool
+		want    []uint64
+		wantErr bool
+	}{
+		{name: "descending ID", query: "the", less: descending, want: []uint64{docThree.ID, docTwo.ID, docOne.ID}},
+		{name: "stable", query: "the", less: seaFirst, want: []uint64{docTwo.ID, docThree.ID, docOne.ID}},
+		{name: "no results", query: "zebra", less: descending, want: []uint64{}},
+		{name: "no comparator", query: "the", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.SearchSorted(ctx, tt.query, tt.less)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Service.SearchSorted() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.SearchSorted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_SearchTerms(t *testing.T) {
+	ctx := context.TODO()
+	docs := []Doc{{ID: 1, Text: "A well-known fact"}, {ID: 2, Text: "Well known facts"}}
+	// the client splits on whitespace only, keeping hyphenated words whole
+	whitespace := NewService(WithTokenizer(TokenizerFunc(func(text string) []string {
+		return strings.Fields(strings.ToLower(text))
+	})))
+	standard := NewService()
+	for _, svc := range []*Service{whitespace, standard} {
+		if err := svc.Upsert(ctx, docs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name    string
+		svc     *Service
+		terms   []string
+		want    []uint64
+		wantErr bool
+	}{
+		{name: "hyphenated term kept whole", svc: whitespace, terms: []string{"well-known"}, want: []uint64{1}},
+		{name: "prefix of a hyphenated term", svc: whitespace, terms: []string{"well-kn"}, want: []uint64{1}},
+		{name: "separate terms", svc: whitespace, terms: []string{"well", "known"}, want: []uint64{2}},
+		{name: "term the Tokenizer splits", svc: standard, terms: []string{"well-known"}, want: []uint64{}},
+		{name: "terms as the Tokenizer splits them", svc: standard, terms: []string{"well", "known"}, want: []uint64{1, 2}},
+		{name: "empty terms", svc: standard, terms: []string{"", ""}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.svc.SearchTerms(ctx, tt.terms)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Service.SearchTerms() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.SearchTerms() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	// Search splits the query with the Tokenizer, so it cannot tell the two apart
+	got, err := standard.Search(ctx, "well-known")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.Search() = %v, want %v", got, want)
+	}
+	// WithMaxQueryBreadth only applies to Search and SearchWith
+	narrow := NewService(WithMaxQueryBreadth(0.5))
+	if err := narrow.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := narrow.Search(ctx, "well"); err != ErrQueryTooBroad {
+		t.Errorf("Service.Search() error = %v, want %v", err, ErrQueryTooBroad)
+	}
+	got, err = narrow.SearchTerms(ctx, []string{"well"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.SearchTerms() = %v, want %v", got, want)
+	}
+}
+
+func TestService_Search_whitespace(t *testing.T) {
+	ctx := context.TODO()
+	// splitting on single spaces yields empty tokens around extra whitespace
+	spaces := TokenizerFunc(func(text string) []string { return strings.Split(strings.ToLower(text), " ") })
+	services := map[string]*Service{
+		"default":          NewService(),
+		"split":            NewService(WithTokenizer(spaces)),
+		"split unanchored": NewService(WithTokenizer(spaces), WithSubstringMatching()),
+	}
+	tests := []struct {
+		query   string
+		want    []uint64
+		wantErr bool
+	}{
+		{query: " fox ", want: []uint64{docOne.ID}},
+		{query: "  fox", want: []uint64{docOne.ID}},
+		{query: "sea  shells", want: []uint64{docTwo.ID, docThree.ID}},
+		{query: "fox  sea", want: []uint64{}},
+		{query: "   ", wantErr: true},
+		{query: "", wantErr: true},
+	}
+	for name, svc := range services {
+		if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s/%q", name, tt.query), func(t *testing.T) {
+				got, err := svc.Search(ctx, tt.query)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Service.Search() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Service.Search() = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestService_SearchExcludingAll(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		terms   []string
+		want    []uint64
+		wantErr bool
+	}{
+		{name: "one term", terms: []string{"fox"}, want: []uint64{docTwo.ID, docThree.ID}},
+		{name: "any term excludes", terms: []string{"sea", "pick"}, want: []uint64{docOne.ID}},
+		{name: "prefix", terms: []string{"jump"}, want: []uint64{docTwo.ID}},
+		{name: "every document excluded", terms: []string{"the"}, want: []uint64{}},
+		{name: "no document excluded", terms: []string{"zebra"}, want: []uint64{docOne.ID, docTwo.ID, docThree.ID}},
+		{name: "a term needs all of its words", terms: []string{"peter fox"}, want: []uint64{docOne.ID, docTwo.ID, docThree.ID}},
+		{name: "no terms", terms: nil, wantErr: true},
+		{name: "term without content", terms: []string{"fox", "a"}, wantErr: true},
+		{name: "cancelled", ctx: cancelled, terms: []string{"fox"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.ctx == nil {
+				tt.ctx = ctx
+			}
+			got, err := svc.SearchExcludingAll(tt.ctx, tt.terms)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Service.SearchExcludingAll() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.SearchExcludingAll() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	// the results are exactly the documents that Search does not return for any term
+	terms := []string{"sea", "quick"}
+	excluded := map[uint64]bool{}
+	for _, term := range terms {
+		ids, err := svc.Search(ctx, term)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range ids {
+			excluded[id] = true
+		}
+	}
+	got, err := svc.SearchExcludingAll(ctx, terms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range svc.IDs() {
+		if slices.Contains(got, id) == excluded[id] {
+			t.Errorf("document %d: excluded = %v, but returned = %v", id, excluded[id], slices.Contains(got, id))
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package fulltext
+
+import (
+	"strings"
+	"unicode"
+)
+
+// secondaryMarker begins each secondary form stored for a document.  It is a byte that
+// never occurs in valid UTF-8 and that escape never produces, so the trigrams and
+// suffix array entries of secondary forms cannot be mistaken for those of words.
+const secondaryMarker = "\xfd"
+
+// isSecondary reports whether an indexed entry is a secondary form rather than a word
+func isSecondary(entry string) bool {
+	return strings.HasPrefix(entry, secondaryMarker)
+}
+
+// secondaryForm returns the marked secondary form of an analyzed word, or an empty
+// string when the word has none
+func (svc *Service) secondaryForm(word string) string {
+	bare := unescaper.Replace(strings.TrimPrefix(strings.Trim(word, saDelim), `_`))
+	form := svc.secondary(bare)
+	if len(form) == 0 {
+		return ``
+	}
+	return secondaryMarker + escape([]string{form})[0]
+}
+
+// secondaryForms returns the marked secondary forms of analyzed words, or nil when the
+// Service has no secondary analyzer
+func (svc *Service) secondaryForms(words []string) []string {
+	if svc.secondary == nil {
+		return nil
+	}
+	var forms []string
+	for _, word := range words {
+		if form := svc.secondaryForm(word); len(form) > 0 {
+			forms = append(forms, form)
+		}
+	}
+	return forms
+}
+
+// withSecondary appends the secondary form of each query word to its group, creating
+// one group per word if there are no synonyms.  Forms keep the word's trailing
+// delimiter, so AnchorWhole requires the whole form to match.
+func (svc *Service) withSecondary(words []string, groups [][]string) [][]string {
+	if groups == nil {
+		groups = make([][]string, len(words))
+		for i, word := range words {
+			groups[i] = []string{word}
+		}
+	}
+	for i, word := range words {
+		form := svc.secondaryForm(word)
+		if len(form) == 0 {
+			continue
+		}
+		if strings.HasSuffix(word, saDelim) {
+			form += saDelim
+		}
+		groups[i] = append(groups[i], form)
+	}
+	return groups
+}
+
+// soundexCodes maps the consonants Soundex encodes to their digits
+var soundexCodes = map[rune]byte{
+	'b': '1', 'f': '1', 'p': '1', 'v': '1',
+	'c': '2', 'g': '2', 'j': '2', 'k': '2', 'q': '2', 's': '2', 'x': '2', 'z': '2',
+	'd': '3', 't': '3',
+	'l': '4',
+	'm': '5', 'n': '5',
+	'r': '6',
+}
+
+// Soundex returns the American Soundex code of word, such as "S530" for both "Smith"
+// and "Smyth", for use with WithSecondaryAnalyzer.  Letters other than a to z are
+// ignored, and a word without any has no code.
+func Soundex(word string) string {
+	code := make([]byte, 0, 4)
+	var last byte
+	for _, r := range strings.ToLower(word) {
+		if r > unicode.MaxASCII || !unicode.IsLetter(r) {
+			continue
+		}
+		digit := soundexCodes[r]
+		switch {
+		case len(code) == 0:
+			code = append(code, byte(unicode.ToUpper(r)))
+		case digit != 0 && digit != last:
+			code = append(code, digit)
+		}
+		if len(code) == 4 {
+			break
+		}
+		if r != 'h' && r != 'w' {
+			// vowels separate consonants with the same code, but h and w do not
+			last = digit
+		}
+	}
+	if len(code) == 0 {
+		return ``
+	}
+	for len(code) < 4 {
+		code = append(code, '0')
+	}
+	return string(code)
+}
@@ -0,0 +1,93 @@
+package fulltext
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestSoundex(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{word: "Smith", want: "S530"},
+		{word: "Smyth", want: "S530"},
+		{word: "Robert", want: "R163"},
+		{word: "Rupert", want: "R163"},
+		{word: "Ashcraft", want: "A261"},
+		{word: "Tymczak", want: "T522"},
+		{word: "Pfister", want: "P236"},
+		{word: "Schmidt", want: "S530"},
+		{word: "Lee", want: "L000"},
+		{word: "O'Hara", want: "O600"},
+		{word: "42", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			if got := Soundex(tt.word); got != tt.want {
+				t.Errorf("Soundex() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_SearchWith_secondary(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService(WithSecondaryAnalyzer(Soundex))
+	smyth := Doc{ID: 1, Text: "John Smyth"}
+	docs := []Doc{smyth, {ID: 2, Text: "Jane Smith"}, {ID: 3, Text: "Joan Jones"}}
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	search := func(query string, opts SearchOptions) []uint64 {
+		t.Helper()
+		got, _, err := svc.SearchWith(ctx, query, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	secondary := SearchOptions{Secondary: true}
+	tests := []struct {
+		name  string
+		query string
+		opts  SearchOptions
+		want  []uint64
+	}{
+		{name: "as typed", query: "smith", want: []uint64{2}},
+		{name: "phonetic", query: "smith", opts: secondary, want: []uint64{1, 2}},
+		{name: "every word must match", query: "jones smith", opts: secondary, want: []uint64{}},
+		{name: "whole", query: "smyth", opts: SearchOptions{Secondary: true, Anchor: AnchorWhole}, want: []uint64{1, 2}},
+		{name: "secondary forms are not words", query: "s530", want: []uint64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := search(tt.query, tt.opts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.SearchWith() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if got, want := svc.docs[svc.extIDs[smyth.ID]].words(), []string{"_john", "_smyth"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("meta.words() = %q, want %q", got, want)
+	}
+
+	// updates remove the secondary forms of the prior text
+	smithers := Doc{ID: smyth.ID, Text: "John Smithers", PriorText: smyth.Text}
+	if err := svc.Upsert(ctx, []Doc{smithers}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Validate(); err != nil {
+		t.Errorf("Service.Validate() after update: %v", err)
+	}
+	if got, want := search("smyth", secondary), []uint64{2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.SearchWith() after update = %v, want %v", got, want)
+	}
+	svc.Reindex()
+	if got, want := search("smyth", secondary), []uint64{2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.SearchWith() after Reindex = %v, want %v", got, want)
+	}
+	if _, _, err := NewService().SearchWith(ctx, "smith", secondary); err == nil {
+		t.Error("Service.SearchWith() should reject secondary queries without a secondary analyzer")
+	}
+}
@@ -0,0 +1,116 @@
+package fulltext
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ShardedService partitions documents across several independent Services by a hash
+// of their external ID, so that each shard has its own lock.  Upserts and deletes
+// only lock the shards holding the affected documents, letting searches proceed on
+// the other shards, and searches verify candidates on every shard in parallel.
+// Documents are routed by external ID rather than internal ID because internal IDs
+// are only assigned once a document has been added to a shard.
+//
+// A ShardedService suits read-heavy workloads with frequent small updates.  An Upsert
+// spanning several shards is not atomic: it is applied shard by shard, and if a later
+// shard rejects its documents, earlier shards keep theirs.
+type ShardedService struct {
+	shards []*Service
+}
+
+// NewShardedService initializes a ShardedService with n shards, each configured
+// with opts.  A sink registered with WithChangeSink receives the changes of every
+// shard, one at a time.  Call Close to stop background compaction in every shard.
+func NewShardedService(n int, opts ...Option) *ShardedService {
+	if n < 1 {
+		n = 1
+	}
+	shards := make([]*Service, n)
+	var mu sync.Mutex // serializes delivery to a shared ChangeSink
+	for i := range shards {
+		shards[i] = NewService(opts...)
+		if sink := shards[i].changeSink; sink != nil {
+			shards[i].changeSink = func(c Change) {
+				mu.Lock()
+				defer mu.Unlock()
+				sink(c)
+			}
+		}
+	}
+	return &ShardedService{shards: shards}
+}
+
+// Close stops the background compaction of every shard, as Service.Close does
+func (s *ShardedService) Close() error {
+	for _, shard := range s.shards {
+		if err := shard.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shard returns the shard responsible for the document with the given external ID
+func (s *ShardedService) shard(id uint64) *Service {
+	// Fibonacci hashing spreads sequential IDs evenly across shards
+	return s.shards[(id*0x9E3779B97F4A7C15)>>32%uint64(len(s.shards))]
+}
+
+// DocCount returns the number of documents in the index
+func (s *ShardedService) DocCount() (n int) {
+	for _, shard := range s.shards {
+		n += shard.DocCount()
+	}
+	return
+}
+
+// Upsert adds or updates documents in the full text index
+func (s *ShardedService) Upsert(ctx context.Context, docs []Doc) error {
+	batches := make(map[*Service][]Doc)
+	for _, doc := range docs {
+		shard := s.shard(doc.ID)
+		batches[shard] = append(batches[shard], doc)
+	}
+	for _, shard := range s.shards {
+		if batch, ok := batches[shard]; ok {
+			if err := shard.Upsert(ctx, batch); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Delete removes a document from the full text index
+func (s *ShardedService) Delete(ctx context.Context, id uint64) error {
+	return s.shard(id).Delete(ctx, id)
+}
+
+// Search performs a fulltext search on every shard in parallel.  Results are grouped
+// by shard rather than in insertion order.
+func (s *ShardedService) Search(ctx context.Context, query string) ([]uint64, error) {
+	results := make([][]uint64, len(s.shards))
+	errs := make([]error, len(s.shards))
+	var wg sync.WaitGroup
+	for i, shard := range s.shards {
+		wg.Add(1)
+		go func(i int, shard *Service) {
+			defer wg.Done()
+			results[i], errs[i] = shard.Search(ctx, query)
+		}(i, shard)
+	}
+	wg.Wait()
+	var docIDs []uint64
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf(`shard %d: %w`, i, err)
+		}
+		docIDs = append(docIDs, results[i]...)
+	}
+	if docIDs == nil {
+		docIDs = []uint64{}
+	}
+	return docIDs, nil
+}
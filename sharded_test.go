@@ -0,0 +1,137 @@
+package fulltext
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShardedService_Search(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewShardedService(4)
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	if svc.DocCount() != 3 {
+		t.Errorf("ShardedService.DocCount() = %d, want %d", svc.DocCount(), 3)
+	}
+	tests := []struct {
+		query   string
+		want    []uint64
+		wantErr bool
+	}{
+		{query: "fox", want: []uint64{docOne.ID}},
+		{query: "jump", want: []uint64{docOne.ID, docThree.ID}},
+		{query: "sea shells", want: []uint64{docTwo.ID, docThree.ID}},
+		{query: "picpep", want: []uint64{}},
+		{query: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := svc.Search(ctx, tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ShardedService.Search() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ShardedService.Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if err := svc.Delete(ctx, docThree.ID); err != nil {
+		t.Fatal(err)
+	}
+	got, err := svc.Search(ctx, "jump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{docOne.ID}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ShardedService.Search() = %v, want %v", got, want)
+	}
+}
+
+// index abstracts over Service and ShardedService for the benchmarks
+type index interface {
+	Upsert(ctx context.Context, docs []Doc) error
+	Search(ctx context.Context, query string) ([]uint64, error)
+}
+
+// benchmarkMixed runs searches on every goroutine, with one operation in ten
+// updating a random document
+func benchmarkMixed(b *testing.B, svc index) {
+	ctx := context.TODO()
+	const n = 5000
+	docs := make([]Doc, n)
+	for i := range docs {
+		docs[i] = Doc{ID: uint64(i + 1), Text: fmt.Sprintf("document %d about %s", i, docThree.Text)}
+	}
+	if err := svc.Upsert(ctx, docs); err != nil {
+		b.Fatal(err)
+	}
+	var seed int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := rand.New(rand.NewSource(atomic.AddInt64(&seed, 1)))
+		for i := 0; pb.Next(); i++ {
+			if i%10 == 0 {
+				doc := docs[r.Intn(n)]
+				doc.PriorText = doc.Text
+				doc.Text += " updated"
+				// concurrent updates of the same document may race on PriorText;
+				// that only leaves stale postings behind, which is fine here
+				_ = svc.Upsert(ctx, []Doc{doc})
+				continue
+			}
+			if _, err := svc.Search(ctx, "pickled pep"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkService_mixed(b *testing.B) {
+	benchmarkMixed(b, NewService())
+}
+
+func BenchmarkShardedService_mixed(b *testing.B) {
+	benchmarkMixed(b, NewShardedService(8))
+}
+
+func TestShardedService_changeSink(t *testing.T) {
+	ctx := context.TODO()
+	var delivering, overlaps, received atomic.Int32
+	sink := func(Change) {
+		if delivering.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		received.Add(1)
+		delivering.Add(-1)
+	}
+	svc := NewShardedService(4, WithChangeSink(sink))
+	defer svc.Close()
+	done := make(chan error)
+	for i := 0; i < 4; i++ {
+		go func(i int) {
+			var err error
+			for id := uint64(i*100 + 1); id <= uint64(i*100+50) && err == nil; id++ {
+				err = svc.Upsert(ctx, []Doc{{ID: id, Text: fmt.Sprintf("document %d", id)}})
+			}
+			done <- err
+		}(i)
+	}
+	for i := 0; i < 4; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := received.Load(); got != 200 {
+		t.Errorf("ChangeSink received %d changes, want %d", got, 200)
+	}
+	if n := overlaps.Load(); n > 0 {
+		t.Errorf("ChangeSink was called concurrently %d times", n)
+	}
+}
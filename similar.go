@@ -0,0 +1,116 @@
+package fulltext
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/dgryski/go-trigram"
+)
+
+// SimilarTo returns up to limit documents that are most similar to the document with
+// external ID id, most similar first, excluding the document itself.  A limit of zero
+// or less returns every similar document.
+//
+// Similarity is the Jaccard index of the two documents' trigram sets: the number of
+// trigrams they share divided by the number of distinct trigrams in either.  Scores
+// range from 0 (no trigrams in common, never returned) to 1 (identical trigram sets);
+// ties are broken by ascending external ID.  Candidates are drawn from the posting
+// lists of the document's trigrams, but if any of its trigrams has been pruned every
+// document must be scored.
+func (svc *Service) SimilarTo(ctx context.Context, id uint64, limit int) ([]uint64, error) {
+	if err := svc.acquireSearch(); err != nil {
+		return nil, err
+	}
+	defer svc.releaseSearch()
+	svc.RLock()
+	defer svc.RUnlock()
+	srcID, ok := svc.extIDs[id]
+	if !ok {
+		return nil, fmt.Errorf(`document %d is not indexed`, id)
+	}
+	src := trigramSet(svc.docs[srcID].words())
+	type scored struct {
+		id    uint64
+		score float64
+	}
+	var results []scored
+	for _, docID := range svc.similarCandidates(src) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		doc, ok := svc.docs[docID]
+		if !ok || docID == srcID {
+			continue
+		}
+		if score := jaccard(src, trigramSet(doc.words())); score > 0 {
+			results = append(results, scored{id: doc.id, score: score})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].id < results[j].id
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	docIDs := make([]uint64, len(results))
+	for i, r := range results {
+		docIDs[i] = r.id
+	}
+	return docIDs, nil
+}
+
+// similarCandidates returns the internal IDs of documents sharing at least one of the
+// trigrams, or of every document when any of them has been pruned.  The caller must
+// hold the lock.
+func (svc *Service) similarCandidates(tGrams map[trigram.T]struct{}) []trigram.DocID {
+	seen := make(map[trigram.DocID]struct{})
+	for t := range tGrams {
+		posting, ok := svc.idx.Posting(t)
+		if ok && posting == nil {
+			all, _ := svc.idx.Posting(trigram.TAllDocIDs)
+			return all
+		}
+		for _, docID := range posting {
+			seen[docID] = struct{}{}
+		}
+	}
+	docIDs := make([]trigram.DocID, 0, len(seen))
+	for docID := range seen {
+		docIDs = append(docIDs, docID)
+	}
+	return docIDs
+}
+
+// trigramSet returns the distinct trigrams of words
+func trigramSet(words []string) map[trigram.T]struct{} {
+	var tGrams []trigram.T
+	for _, word := range words {
+		tGrams = trigram.Extract(word, tGrams)
+	}
+	set := make(map[trigram.T]struct{}, len(tGrams))
+	for _, t := range tGrams {
+		set[t] = struct{}{}
+	}
+	return set
+}
+
+// jaccard returns the size of the intersection of a and b divided by the size of their union
+func jaccard(a, b map[trigram.T]struct{}) float64 {
+	var shared int
+	for t := range a {
+		if _, ok := b[t]; ok {
+			shared++
+		}
+	}
+	union := len(a) + len(b) - shared
+	if union == 0 {
+		return 0
+	}
+	return float64(shared) / float64(union)
+}
@@ -0,0 +1,73 @@
+package fulltext
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestService_SimilarTo(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		id      uint64
+		limit   int
+		want    []uint64
+		wantErr bool
+	}{
+		{
+			name:  "docThree shares 'sea shells' with docTwo",
+			id:    docTwo.ID,
+			limit: 1,
+			want:  []uint64{docThree.ID},
+		},
+		{
+			name:  "every similar document, most similar first",
+			id:    docTwo.ID,
+			limit: 0,
+			want:  []uint64{docThree.ID, docOne.ID},
+		},
+		{
+			name:    "unknown document",
+			id:      42,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.SimilarTo(ctx, tt.id, tt.limit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Service.SimilarTo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.SimilarTo() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_SimilarTo_unpruned(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	// enough unrelated documents that the trigrams of the interesting ones are not pruned
+	var docs []Doc
+	for id := uint64(100); id < 150; id++ {
+		docs = append(docs, Doc{ID: id, Text: fmt.Sprintf("filler%d", id)})
+	}
+	docs = append(docs, docOne, docTwo, docThree)
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	got, err := svc.SimilarTo(ctx, docTwo.ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{docThree.ID, docOne.ID}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.SimilarTo() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+package fulltext
+
+import (
+	"sort"
+
+	"github.com/dgryski/go-trigram"
+)
+
+// TrigramStat describes the posting list of a trigram in the index
+type TrigramStat struct {
+	Trigram string // the trigram's three bytes; a leading underscore marks the start of a word
+	Docs    int    // the number of documents the trigram is posted for
+	Pruned  bool   // whether the posting list was pruned because the trigram is too common
+}
+
+// TopTrigrams returns the n trigrams posted for the most documents, most common first,
+// with ties broken by trigram; a negative n returns every trigram.  Counting pruned
+// trigrams scans every document, so it is meant for tuning, not for each query.
+func (svc *Service) TopTrigrams(n int) []TrigramStat {
+	svc.RLock()
+	defer svc.RUnlock()
+	pruned := make(map[trigram.T]int)
+	var stats []TrigramStat
+	svc.idx.Range(func(t trigram.T, posting []trigram.DocID) {
+		switch {
+		case t == trigram.TAllDocIDs:
+		case posting == nil:
+			pruned[t] = 0
+		default:
+			stats = append(stats, TrigramStat{Trigram: trigramString(t), Docs: len(posting)})
+		}
+	})
+	if len(pruned) > 0 {
+		var tGrams []trigram.T
+		for _, doc := range svc.docs {
+			tGrams = tGrams[:0]
+			for _, word := range doc.entries() {
+				tGrams = svc.extract(word, tGrams)
+			}
+			for _, t := range tGrams {
+				if _, ok := pruned[t]; ok {
+					pruned[t]++
+				}
+			}
+		}
+		for t, docs := range pruned {
+			stats = append(stats, TrigramStat{Trigram: trigramString(t), Docs: docs, Pruned: true})
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Docs != stats[j].Docs {
+			return stats[i].Docs > stats[j].Docs
+		}
+		return stats[i].Trigram < stats[j].Trigram
+	})
+	if n >= 0 && len(stats) > n {
+		stats = stats[:n]
+	}
+	return stats
+}
+
+// trigramString returns the three bytes packed into t
+func trigramString(t trigram.T) string {
+	return string([]byte{byte(t >> 16), byte(t >> 8), byte(t)})
+}
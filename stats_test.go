@@ -0,0 +1,55 @@
+package fulltext
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestService_TopTrigrams(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	// every trigram occurs in more than a tenth of three documents, so all are pruned
+	want := []TrigramStat{{Trigram: "_th", Docs: 3, Pruned: true}, {Trigram: "the", Docs: 3, Pruned: true}}
+	if got := svc.TopTrigrams(2); !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.TopTrigrams(2) = %v, want %v", got, want)
+	}
+	all := svc.TopTrigrams(-1)
+	for i, stat := range all {
+		if stat.Trigram == "sea" {
+			if stat.Docs != 2 {
+				t.Errorf("Service.TopTrigrams() 'sea' Docs = %d, want %d", stat.Docs, 2)
+			}
+			if all[i-1].Docs < 2 {
+				t.Errorf("Service.TopTrigrams() ranks %v above 'sea'", all[i-1])
+			}
+		}
+	}
+	if got := svc.TopTrigrams(0); len(got) != 0 {
+		t.Errorf("Service.TopTrigrams(0) = %v, want none", got)
+	}
+}
+
+func TestService_TopTrigrams_skewed(t *testing.T) {
+	svc := NewService()
+	if err := svc.Upsert(context.TODO(), skewedCorpus()); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]TrigramStat{
+		"_fi": {Trigram: "_fi", Docs: 1000, Pruned: true},
+		"_al": {Trigram: "_al", Docs: 290, Pruned: true},
+		"_br": {Trigram: "_br", Docs: 90},
+	}
+	got := make(map[string]TrigramStat)
+	for _, stat := range svc.TopTrigrams(-1) {
+		if _, ok := want[stat.Trigram]; ok {
+			got[stat.Trigram] = stat
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.TopTrigrams() = %v, want %v", got, want)
+	}
+}
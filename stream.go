@@ -0,0 +1,101 @@
+package fulltext
+
+import (
+	"context"
+	"io"
+
+	"github.com/dgryski/go-trigram"
+)
+
+// SearchStream performs the same search as Search, but sends each matching
+// docID on the returned results channel as soon as it has been verified, so
+// callers can begin rendering before the search completes.  The results channel
+// is closed when the search finishes or ctx is cancelled.  At most one error is
+// sent on the error channel, which is closed after the results channel.
+//
+// The index is read locked for the lifetime of the stream: Upsert and other
+// writers block until the consumer drains the results channel or cancels ctx.
+// Consumers that stop reading early must cancel ctx to release the lock.
+func (svc *Service) SearchStream(ctx context.Context, query string) (<-chan uint64, <-chan error) {
+	results := make(chan uint64)
+	errc := make(chan error, 1)
+	if err := svc.acquireSearch(); err != nil {
+		errc <- err
+		close(results)
+		close(errc)
+		return results, errc
+	}
+	q, err := svc.newQuery(query, SearchOptions{})
+	if err != nil {
+		svc.releaseSearch()
+		errc <- err
+		close(results)
+		close(errc)
+		return results, errc
+	}
+	svc.RLock()
+	go func() {
+		defer close(errc)
+		defer close(results)
+		defer svc.releaseSearch()
+		defer svc.RUnlock()
+		defer q.release()
+		var err error
+		verr := svc.verify(ctx, svc.queryCandidates(q), q.matches, func(_ trigram.DocID, doc meta) bool {
+			select {
+			case results <- doc.id:
+				return true
+			case <-ctx.Done():
+				err = ctx.Err()
+				return false
+			}
+		})
+		if verr != nil {
+			err = verr
+		}
+		if err != nil {
+			errc <- err
+		}
+	}()
+	return results, errc
+}
+
+// SearchWriteTexts performs the same search as Search, writing the original text of each
+// matching document to w as soon as it has been verified, with sep between consecutive
+// texts, so that reports can be generated without holding every result in memory.  It
+// returns the first error from w, or ctx's error if ctx is done before the search
+// finishes; either way, the texts already written remain written.
+//
+// Like SearchStream, the index is read locked until the search finishes, so a slow w
+// blocks Upsert and other writers.
+func (svc *Service) SearchWriteTexts(ctx context.Context, query string, w io.Writer, sep []byte) error {
+	if err := svc.acquireSearch(); err != nil {
+		return err
+	}
+	defer svc.releaseSearch()
+	q, err := svc.newQuery(query, SearchOptions{})
+	if err != nil {
+		return err
+	}
+	defer q.release()
+	svc.RLock()
+	defer svc.RUnlock()
+	var written bool
+	var werr error
+	err = svc.verify(ctx, svc.queryCandidates(q), q.matches, func(_ trigram.DocID, doc meta) bool {
+		if written {
+			if _, werr = w.Write(sep); werr != nil {
+				return false
+			}
+		}
+		if _, werr = io.WriteString(w, doc.text); werr != nil {
+			return false
+		}
+		written = true
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return werr
+}
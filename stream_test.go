@@ -0,0 +1,108 @@
+package fulltext
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestService_SearchStream(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		query   string
+		wantErr bool
+	}{
+		{name: "single match", query: "fox"},
+		{name: "multiple matches", query: "jump"},
+		{name: "no matches", query: "zebra"},
+		{name: "empty query", query: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, wantErr := svc.Search(ctx, tt.query)
+			if (wantErr != nil) != tt.wantErr {
+				t.Fatalf("Service.Search() error = %v, wantErr %v", wantErr, tt.wantErr)
+			}
+			results, errc := svc.SearchStream(ctx, tt.query)
+			var got []uint64
+			for id := range results {
+				got = append(got, id)
+			}
+			err := <-errc
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Service.SearchStream() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(want) || (len(got) > 0 && !reflect.DeepEqual(got, want)) {
+				t.Errorf("Service.SearchStream() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestService_SearchStream_cancel(t *testing.T) {
+	svc := NewService()
+	if err := svc.Upsert(context.TODO(), []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	results, errc := svc.SearchStream(ctx, "jump")
+	if _, ok := <-results; !ok {
+		t.Fatal("Service.SearchStream() closed before sending the first result")
+	}
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("Service.SearchStream() error = %v, want %v", err, context.Canceled)
+	}
+	if id, ok := <-results; ok {
+		t.Errorf("Service.SearchStream() sent %d after cancellation", id)
+	}
+	// the read lock must have been released
+	if err := svc.Upsert(context.TODO(), []Doc{{ID: 4, Text: "jumping jacks"}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestService_SearchWriteTexts(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	tests := []struct {
+		name    string
+		query   string
+		ctx     context.Context
+		want    string
+		wantErr bool
+	}{
+		{name: "two matches", query: "sea shells", want: docTwo.Text + "\n" + docThree.Text},
+		{name: "one match", query: "fox", want: docOne.Text},
+		{name: "no matches", query: "zebra"},
+		{name: "not enough content", query: "a", wantErr: true},
+		{name: "cancelled", query: "sea shells", ctx: cancelled, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.ctx == nil {
+				tt.ctx = ctx
+			}
+			var b bytes.Buffer
+			err := svc.SearchWriteTexts(tt.ctx, tt.query, &b, []byte("\n"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Service.SearchWriteTexts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("Service.SearchWriteTexts() wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
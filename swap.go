@@ -0,0 +1,69 @@
+package fulltext
+
+import (
+	"fmt"
+	"sync"
+)
+
+// swapMu serializes Swap and Merge calls, so that two Services swapped or merged with
+// each other from different goroutines cannot deadlock acquiring their locks in
+// opposite orders
+var swapMu sync.Mutex
+
+// Swap exchanges the indexed documents of svc and other in one step, for deployments
+// that rebuild an index offline and then switch traffic to it.  Searches that acquired
+// the read lock before the swap complete against the old documents and later searches
+// see only the new ones; no search observes a mix.  Afterwards other holds the
+// documents svc held, so it can be swapped back or discarded.  Options such as the
+// Tokenizer are not exchanged, so both Services should be configured identically;
+// Swap refuses Services that differ in WithSuffixIndex or WithSubstringMatching,
+// whose documents would not be searchable under the other configuration.  Checkpoints
+// of both Services are released, since they describe documents that have moved, and
+// each ChangeSink receives the changes needed to bring its replica to the new contents.
+func (svc *Service) Swap(other *Service) error {
+	if other == svc {
+		return fmt.Errorf(`cannot swap an index with itself`)
+	}
+	swapMu.Lock()
+	defer swapMu.Unlock()
+	svc.Lock()
+	defer svc.Unlock()
+	other.Lock()
+	defer other.Unlock()
+	if svc.suffixes != other.suffixes || svc.unanchored != other.unanchored {
+		return fmt.Errorf(`cannot swap indexes that differ in WithSuffixIndex or WithSubstringMatching`)
+	}
+	svc.emitReplacement(other)
+	other.emitReplacement(svc)
+	svc.docs, other.docs = other.docs, svc.docs
+	svc.extIDs, other.extIDs = other.extIDs, svc.extIDs
+	svc.idx, other.idx = other.idx, svc.idx
+	// suffix arrays are accounted for by the cache of the Service that built them
+	svc.saCache, other.saCache = other.saCache, svc.saCache
+	svc.mutations, other.mutations = other.mutations, svc.mutations
+	svc.checkpoints, other.checkpoints = nil, nil
+	svc.generation++
+	other.generation++
+	svc.epoch++
+	other.epoch++
+	return nil
+}
+
+// emitReplacement emits the changes that turn the documents of svc into those of
+// replacement.  The caller must hold both write locks.
+func (svc *Service) emitReplacement(replacement *Service) {
+	if svc.changeSink == nil {
+		return
+	}
+	for id, docID := range svc.extIDs {
+		if _, ok := replacement.extIDs[id]; !ok {
+			svc.emit(Change{Op: OpDelete, ID: svc.docs[docID].id})
+		}
+	}
+	for id, docID := range replacement.extIDs {
+		doc := replacement.docs[docID]
+		if current, ok := svc.extIDs[id]; !ok || svc.docs[current].text != doc.text {
+			svc.emit(Change{Op: OpUpsert, ID: id, Text: doc.text})
+		}
+	}
+}
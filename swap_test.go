@@ -0,0 +1,107 @@
+package fulltext
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestService_Swap(t *testing.T) {
+	ctx := context.TODO()
+	var replica []Change
+	blue := NewService(WithChangeSink(func(c Change) { replica = append(replica, c) }))
+	green := NewService(WithMaxSuffixArrays(2))
+	var blueDocs, greenDocs []Doc
+	for i := uint64(1); i <= 50; i++ {
+		blueDocs = append(blueDocs, Doc{ID: i, Text: fmt.Sprintf("alpha blue %d", i)})
+		greenDocs = append(greenDocs, Doc{ID: 100 + i, Text: fmt.Sprintf("alpha green %d", i)})
+	}
+	if err := blue.Upsert(ctx, blueDocs); err != nil {
+		t.Fatal(err)
+	}
+	if err := green.Upsert(ctx, greenDocs); err != nil {
+		t.Fatal(err)
+	}
+	wantBlue, err := blue.Search(ctx, "alpha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantGreen, err := green.Search(ctx, "alpha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := blue.Checkpoint()
+	replica = nil
+
+	// every search sees either the old or the new documents, never a mix
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				got, err := blue.Search(ctx, "alpha")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !reflect.DeepEqual(got, wantBlue) && !reflect.DeepEqual(got, wantGreen) {
+					t.Errorf("Service.Search() = %v during Swap, want all blue or all green documents", got)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		if err := blue.Swap(green); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	// after an odd number of swaps each Service holds the documents the other started with
+	if err := blue.Swap(green); err != nil {
+		t.Fatal(err)
+	}
+	got, err := blue.Search(ctx, "alpha green")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, wantGreen) {
+		t.Errorf("Service.Search() = %v after Swap, want %v", got, wantGreen)
+	}
+	got, err = green.Search(ctx, "blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, wantBlue) {
+		t.Errorf("other Service.Search() = %v after Swap, want %v", got, wantBlue)
+	}
+	for _, svc := range []*Service{blue, green} {
+		if err := svc.Validate(); err != nil {
+			t.Errorf("Service.Validate() = %v after Swap", err)
+		}
+	}
+	if err := blue.Rollback(token); err == nil {
+		t.Error("Service.Rollback() succeeded with a checkpoint taken before Swap")
+	}
+	// the replica saw the documents replaced 21 times
+	if want := 21 * 2 * len(blueDocs); len(replica) != want {
+		t.Errorf("ChangeSink received %d changes, want %d", len(replica), want)
+	}
+	if err := blue.Swap(blue); err == nil {
+		t.Error("Service.Swap() with itself should fail")
+	}
+	if err := blue.Swap(NewService(WithSuffixIndex())); err == nil {
+		t.Error("Service.Swap() should fail when only one Service uses WithSuffixIndex")
+	}
+}
@@ -0,0 +1,120 @@
+package fulltext
+
+import (
+	"strings"
+
+	"github.com/dgryski/go-trigram"
+)
+
+// normalizeSynonyms returns synonyms with each key and synonym analyzed by tokenize,
+// dropping entries that do not tokenize to exactly one word
+func normalizeSynonyms(synonyms map[string][]string, tokenize func(string) []string) map[string][]string {
+	single := func(s string) (string, bool) {
+		words := tokenize(s)
+		if len(words) != 1 {
+			return ``, false
+		}
+		return words[0], true
+	}
+	normalized := make(map[string][]string, len(synonyms))
+	for key, values := range synonyms {
+		word, ok := single(key)
+		if !ok {
+			continue
+		}
+		for _, value := range values {
+			if syn, ok := single(value); ok && syn != word {
+				normalized[word] = append(normalized[word], syn)
+			}
+		}
+	}
+	return normalized
+}
+
+// expand returns, for each analyzed query word, the word followed by its synonyms
+// anchored the same way as the word.  It returns nil when no word has synonyms.
+func (svc *Service) expand(words []string) [][]string {
+	if len(svc.synonyms) == 0 {
+		return nil
+	}
+	groups := make([][]string, len(words))
+	var expanded bool
+	for i, word := range words {
+		groups[i] = []string{word}
+		bare := strings.TrimPrefix(strings.Trim(word, saDelim), `_`)
+		for _, syn := range svc.synonyms[bare] {
+			groups[i] = append(groups[i], strings.Replace(word, bare, syn, 1))
+			expanded = true
+		}
+	}
+	if !expanded {
+		return nil
+	}
+	return groups
+}
+
+// groupCandidates returns, in ascending order, the internal IDs of documents that may
+// contain at least one word from every group.  The caller must hold the lock.
+func (svc *Service) groupCandidates(groups [][]string) (docIDs []trigram.DocID) {
+	var tGrams []trigram.T
+	for i, group := range groups {
+		var any []trigram.DocID
+		for _, word := range group {
+			tGrams = trigram.Extract(strings.Trim(word, saDelim), tGrams[:0])
+			any = unionDocIDs(any, svc.idx.QueryTrigrams(tGrams))
+		}
+		if i == 0 {
+			docIDs = any
+		} else {
+			docIDs = intersectDocIDs(docIDs, any)
+		}
+	}
+	return
+}
+
+// containsAny reports whether the document contains at least one word from every group
+func (m meta) containsAny(groups [][]string) bool {
+groupLoop:
+	for _, group := range groups {
+		for _, word := range group {
+			if m.sa.Lookup([]byte(word), 1) != nil {
+				continue groupLoop
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// unionDocIDs merges two ascending lists of internal IDs into a new list
+func unionDocIDs(a, b []trigram.DocID) []trigram.DocID {
+	result := make([]trigram.DocID, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0] < b[0]:
+			result, a = append(result, a[0]), a[1:]
+		case a[0] > b[0]:
+			result, b = append(result, b[0]), b[1:]
+		default:
+			result, a, b = append(result, a[0]), a[1:], b[1:]
+		}
+	}
+	result = append(result, a...)
+	return append(result, b...)
+}
+
+// intersectDocIDs returns a new list of the internal IDs present in both ascending lists
+func intersectDocIDs(a, b []trigram.DocID) []trigram.DocID {
+	var result []trigram.DocID
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0] < b[0]:
+			a = a[1:]
+		case a[0] > b[0]:
+			b = b[1:]
+		default:
+			result, a, b = append(result, a[0]), a[1:], b[1:]
+		}
+	}
+	return result
+}
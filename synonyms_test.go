@@ -0,0 +1,81 @@
+package fulltext
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestService_Search_synonyms(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService(WithSynonyms(map[string][]string{
+		"couch":  {"sofa", "settee"},
+		"Fox":    {"wolf"},
+		"big":    {"quite large"},
+		"pepper": {"chili"},
+	}))
+	docs := []Doc{
+		{ID: 1, Text: "a red sofa in the den"},
+		{ID: 2, Text: "a green couch by the window"},
+		{ID: 3, Text: "the wolf howled at the moon"},
+		{ID: 4, Text: "a settee and a sofa"},
+		{ID: 5, Text: "a quite large house"},
+	}
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		query string
+		opts  SearchOptions
+		want  []uint64
+	}{
+		{
+			name:  "'couch' matches documents containing the word or its synonyms",
+			query: "couch",
+			want:  []uint64{1, 2, 4},
+		},
+		{
+			name:  "synonyms are one-directional",
+			query: "sofa",
+			want:  []uint64{1, 4},
+		},
+		{
+			name:  "synonym keys are normalized by the tokenizer",
+			query: "fox",
+			want:  []uint64{3},
+		},
+		{
+			name:  "synonyms follow the anchoring of the query word",
+			query: "cou",
+			want:  []uint64{2},
+		},
+		{
+			name:  "every query word must still be satisfied",
+			query: "red couch",
+			want:  []uint64{1},
+		},
+		{
+			name:  "multi-word synonyms are ignored",
+			query: "big",
+			want:  []uint64{},
+		},
+		{
+			name:  "synonyms honor AnchorWhole",
+			query: "couch",
+			opts:  SearchOptions{Anchor: AnchorWhole, Order: OrderIDAsc},
+			want:  []uint64{1, 2, 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := svc.SearchWith(ctx, tt.query, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.SearchWith(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package fulltext
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer splits text into normalized words.  Implementations must be safe
+// for concurrent use and should be deterministic, since documents and queries
+// only match when they tokenize the same way.
+type Tokenizer interface {
+	Tokenize(text string) []string
+}
+
+// Span locates a word within the text it was extracted from
+type Span struct {
+	Offset int // byte offset of the start of the word
+	Length int // length of the word in bytes
+}
+
+// SpanTokenizer is a Tokenizer that can also report where each word was found.
+// A Service only records spans when its Tokenizer implements SpanTokenizer.
+type SpanTokenizer interface {
+	Tokenizer
+	// TokenizeSpans returns the same words as Tokenize, along with the span of
+	// text each word was extracted from
+	TokenizeSpans(text string) (words []string, spans []Span)
+}
+
+// TokenizerFunc adapts an ordinary function to the Tokenizer interface
+type TokenizerFunc func(text string) []string
+
+// Tokenize calls f(text)
+func (f TokenizerFunc) Tokenize(text string) []string {
+	return f(text)
+}
+
+// fold applies WithRepeatFolding to words in place
+func (svc *Service) fold(words []string) []string {
+	if svc.repeatKeep < 1 {
+		return words
+	}
+	for i, word := range words {
+		words[i] = foldRepeats(word, svc.repeatKeep)
+	}
+	return words
+}
+
+// foldRepeats collapses each run of three or more of the same letter in word to keep
+// letters
+func foldRepeats(word string, keep int) string {
+	if !hasRepeats(word) {
+		return word
+	}
+	runes := []rune(word)
+	var b strings.Builder
+	b.Grow(len(word))
+	for i := 0; i < len(runes); {
+		j := i + 1
+		for j < len(runes) && runes[j] == runes[i] {
+			j++
+		}
+		n := j - i
+		if n >= 3 && unicode.IsLetter(runes[i]) {
+			n = keep
+		}
+		for ; n > 0; n-- {
+			b.WriteRune(runes[i])
+		}
+		i = j
+	}
+	return b.String()
+}
+
+// hasRepeats reports whether word contains a run of three or more of the same letter
+func hasRepeats(word string) bool {
+	var prev rune
+	var n int
+	for _, r := range word {
+		if r == prev {
+			n++
+		} else {
+			prev, n = r, 1
+		}
+		if n == 3 && unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// UnicodeTokenizer splits text into runs of Unicode letters, marks and digits and
+// lowercases them.  Unlike the stringy tokenizer it does not transliterate non-ASCII
+// text or remove punctuation from within words (so "don't" becomes "don" and "t"),
+// but it depends only on the standard library.
+var UnicodeTokenizer Tokenizer = unicodeTokenizer{}
+
+type unicodeTokenizer struct{}
+
+func isUnicodeSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.IsMark(r)
+}
+
+func (unicodeTokenizer) Tokenize(text string) []string {
+	words := strings.FieldsFunc(text, isUnicodeSeparator)
+	for i, word := range words {
+		words[i] = strings.ToLower(word)
+	}
+	return words
+}
+
+func (unicodeTokenizer) TokenizeSpans(text string) (words []string, spans []Span) {
+	spans = fieldSpans(text, isUnicodeSeparator)
+	words = make([]string, len(spans))
+	for i, span := range spans {
+		words[i] = strings.ToLower(text[span.Offset : span.Offset+span.Length])
+	}
+	return
+}
+
+// fieldSpans returns the spans of the runs of text separated by runes for which
+// isSep returns true, mirroring strings.FieldsFunc
+func fieldSpans(text string, isSep func(rune) bool) (spans []Span) {
+	start := -1
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if isSep(r) {
+			if start >= 0 {
+				spans = append(spans, Span{Offset: start, Length: i - start})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+		i += size
+	}
+	if start >= 0 {
+		spans = append(spans, Span{Offset: start, Length: len(text) - start})
+	}
+	return
+}
+
+// number matches runs of digits, optionally grouped by commas and with a decimal part
+var number = regexp.MustCompile(`[0-9]+(?:,[0-9]{3})*(?:\.[0-9]+)?`)
+
+// NumberTokenizer wraps base so that numbers are kept intact as single words rather
+// than being split or stripped of punctuation by base.  A number is a run of digits
+// that is not part of a longer word, optionally with comma separated thousands and a
+// decimal part.  Thousands separators are dropped and the decimal point is kept, so
+// "3.99" is indexed as the word "3.99" (matched by the prefixes "3.9" and "3.99") and
+// "1,234.50" as "1234.50" (matched by "123" and "1234.5").  Everything between numbers
+// is tokenized by base.  The result is a SpanTokenizer when base is one.
+func NumberTokenizer(base Tokenizer) Tokenizer {
+	return numberTokenizer{base: base}
+}
+
+type numberTokenizer struct {
+	base Tokenizer
+}
+
+func (t numberTokenizer) Tokenize(text string) []string {
+	words, _ := t.tokenize(text, false)
+	return words
+}
+
+func (t numberTokenizer) TokenizeSpans(text string) (words []string, spans []Span) {
+	return t.tokenize(text, true)
+}
+
+// tokenize implements Tokenize, also returning spans when requested and available
+func (t numberTokenizer) tokenize(text string, withSpans bool) (words []string, spans []Span) {
+	var locs [][]int
+	for _, loc := range number.FindAllStringIndex(text, -1) {
+		if isNumberBoundary(text, loc[0], loc[1]) {
+			locs = append(locs, loc)
+		}
+	}
+	return tokenizeMatches(text, locs, t.base, withSpans, func(match string) []string {
+		return []string{strings.ReplaceAll(match, `,`, ``)}
+	})
+}
+
+// tokenizeMatches tokenizes the text between the non-overlapping matches at locs with
+// base and replaces each match with the words returned by wordsOf, all of which share
+// the match's span.  Spans are returned when requested and base is a SpanTokenizer.
+func tokenizeMatches(text string, locs [][]int, base Tokenizer, withSpans bool, wordsOf func(match string) []string) (words []string, spans []Span) {
+	st, canSpan := base.(SpanTokenizer)
+	withSpans = withSpans && canSpan
+	var start int // start of the text not yet tokenized
+	flush := func(end int) {
+		if !withSpans {
+			words = append(words, base.Tokenize(text[start:end])...)
+			return
+		}
+		segment, segmentSpans := st.TokenizeSpans(text[start:end])
+		for i, span := range segmentSpans {
+			span.Offset += start
+			words = append(words, segment[i])
+			spans = append(spans, span)
+		}
+	}
+	for _, loc := range locs {
+		flush(loc[0])
+		for _, word := range wordsOf(text[loc[0]:loc[1]]) {
+			words = append(words, word)
+			if withSpans {
+				spans = append(spans, Span{Offset: loc[0], Length: loc[1] - loc[0]})
+			}
+		}
+		start = loc[1]
+	}
+	flush(len(text))
+	return
+}
+
+// isNumberBoundary reports whether text[start:end] stands alone rather than being
+// part of a longer word such as "abc123" or "v2"
+func isNumberBoundary(text string, start, end int) bool {
+	if r, _ := utf8.DecodeLastRuneInString(text[:start]); start > 0 && (unicode.IsLetter(r) || unicode.IsNumber(r)) {
+		return false
+	}
+	if r, _ := utf8.DecodeRuneInString(text[end:]); end < len(text) && (unicode.IsLetter(r) || unicode.IsNumber(r)) {
+		return false
+	}
+	return true
+}
+
+// hostname matches a domain name of at least two labels ending in an alphabetic top level domain
+const hostname = `(?:[A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?\.)+[A-Za-z]{2,}`
+
+// address matches, in order of preference, a URL, an email address or a domain name
+var address = regexp.MustCompile(
+	`[A-Za-z][A-Za-z0-9+.-]*://` + hostname + `(?::[0-9]+)?(?:[/?#][^\s]*)?` +
+		`|[A-Za-z0-9._%+-]+@` + hostname +
+		`|` + hostname)
+
+// AddressTokenizer wraps base so that URLs, email addresses and domain names are kept
+// whole, lowercased, alongside their parent domains and the words within them, so that
+// "example.com" matches every address at that domain and "user@example.com" only that
+// address.  Everything between addresses is tokenized by base.
+func AddressTokenizer(base Tokenizer) Tokenizer {
+	return addressTokenizer{base: base}
+}
+
+type addressTokenizer struct {
+	base Tokenizer
+}
+
+func (t addressTokenizer) Tokenize(text string) []string {
+	words, _ := t.tokenize(text, false)
+	return words
+}
+
+func (t addressTokenizer) TokenizeSpans(text string) (words []string, spans []Span) {
+	return t.tokenize(text, true)
+}
+
+// tokenize implements Tokenize, also returning spans when requested and available
+func (t addressTokenizer) tokenize(text string, withSpans bool) (words []string, spans []Span) {
+	var locs [][]int
+	for _, loc := range address.FindAllStringIndex(text, -1) {
+		loc[1] = loc[0] + len(strings.TrimRight(text[loc[0]:loc[1]], `.,;:!?)'"`))
+		if isAddressBoundary(text, loc[0], loc[1]) {
+			locs = append(locs, loc)
+		}
+	}
+	return tokenizeMatches(text, locs, t.base, withSpans, t.addressWords)
+}
+
+// addressWords returns the words indexed for a URL, email address or domain name
+func (t addressTokenizer) addressWords(addr string) []string {
+	addr = strings.ToLower(addr)
+	host, parts := addr, ``
+	if i := strings.Index(addr, `://`); i >= 0 {
+		host = addr[i+3:]
+		end := strings.IndexAny(host, `:/?#`)
+		if end < 0 {
+			end = len(host)
+		}
+		host, parts = host[:end], addr[:i]+` `+host[end:]
+	} else if i := strings.LastIndexByte(addr, '@'); i >= 0 {
+		host, parts = addr[i+1:], addr[:i]
+	}
+	var words []string
+	if addr != host {
+		words = append(words, addr)
+	}
+	for domain := host; strings.Contains(domain, `.`); domain = domain[strings.IndexByte(domain, '.')+1:] {
+		words = append(words, domain)
+	}
+	separate := func(r rune) rune {
+		if isUnicodeSeparator(r) {
+			return ' '
+		}
+		return r
+	}
+	return append(words, t.base.Tokenize(strings.Map(separate, parts+` `+host))...)
+}
+
+// isAddressBoundary reports whether text[start:end] stands alone rather than being
+// part of a longer token, such as a domain name embedded in an invalid email address
+func isAddressBoundary(text string, start, end int) bool {
+	if r, _ := utf8.DecodeLastRuneInString(text[:start]); start > 0 && (unicode.IsLetter(r) || unicode.IsNumber(r) || strings.ContainsRune(`@.-_%+/`, r)) {
+		return false
+	}
+	if r, _ := utf8.DecodeRuneInString(text[end:]); end < len(text) && (unicode.IsLetter(r) || unicode.IsNumber(r) || strings.ContainsRune(`@`, r)) {
+		return false
+	}
+	return true
+}
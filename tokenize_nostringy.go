@@ -0,0 +1,7 @@
+//go:build nostringy
+
+package fulltext
+
+// DefaultTokenizer is the Tokenizer used by a Service unless WithTokenizer is given.
+// Build without the nostringy tag to use StringyTokenizer instead.
+var DefaultTokenizer = UnicodeTokenizer
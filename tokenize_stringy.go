@@ -0,0 +1,44 @@
+//go:build !nostringy
+
+package fulltext
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/nycmonkey/stringy"
+)
+
+var (
+	replacer = strings.NewReplacer(`-`, ` `, `_`, ` `, `:`, ` `, `|`, ` `)
+)
+
+// StringyTokenizer splits text on whitespace and the characters - _ : |, strips
+// punctuation, transliterates non-ASCII text and lowercases the result using
+// github.com/nycmonkey/stringy.  It is unavailable when building with the nostringy tag.
+var StringyTokenizer Tokenizer = stringyTokenizer{}
+
+// DefaultTokenizer is the Tokenizer used by a Service unless WithTokenizer is given.
+// Build with the nostringy tag to use UnicodeTokenizer instead and drop the
+// dependency on github.com/nycmonkey/stringy.
+var DefaultTokenizer = StringyTokenizer
+
+type stringyTokenizer struct{}
+
+func (stringyTokenizer) Tokenize(text string) []string {
+	return stringy.Analyze(replacer.Replace(text))
+}
+
+// TokenizeSpans analyzes each whitespace separated field on its own, which produces
+// the same words as analyzing the whole text because stringy never splits a field
+func (stringyTokenizer) TokenizeSpans(text string) (words []string, spans []Span) {
+	// the replacer substitutes single bytes for single bytes, so offsets are preserved
+	text = replacer.Replace(text)
+	for _, span := range fieldSpans(text, unicode.IsSpace) {
+		for _, word := range stringy.Analyze(text[span.Offset : span.Offset+span.Length]) {
+			words = append(words, word)
+			spans = append(spans, span)
+		}
+	}
+	return
+}
@@ -0,0 +1,47 @@
+//go:build !nostringy
+
+package fulltext
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func TestStringyTokenizer_TokenizeSpans(t *testing.T) {
+	text := "Peter Piper's  PICKLED-peppers: naïve café, 3.99 -- !!"
+	words, spans := StringyTokenizer.(SpanTokenizer).TokenizeSpans(text)
+	if want := StringyTokenizer.Tokenize(text); !reflect.DeepEqual(words, want) {
+		t.Errorf("TokenizeSpans() words = %q, want %q", words, want)
+	}
+	want := []string{"Peter", "Piper's", "PICKLED", "peppers", "naïve", "café,", "3.99"}
+	if len(spans) != len(want) {
+		t.Fatalf("TokenizeSpans() returned %d spans, want %d", len(spans), len(want))
+	}
+	for i, span := range spans {
+		if got := text[span.Offset : span.Offset+span.Length]; got != want[i] {
+			t.Errorf("spans[%d] covers %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestService_Search_normalizerStringy(t *testing.T) {
+	ctx := context.TODO()
+	turkish := func(text string) string { return strings.ToLowerSpecial(unicode.TurkishCase, text) }
+	svc := NewService(WithNormalizer(turkish))
+	if err := svc.Upsert(ctx, []Doc{{ID: 1, Text: "DIYARBAKIR"}}); err != nil {
+		t.Fatal(err)
+	}
+	// transliteration turns the normalized dotless i back into a dotted one
+	for _, query := range []string{"dıyarbakır", "diyarbakir"} {
+		got, err := svc.Search(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []uint64{1}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Service.Search(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
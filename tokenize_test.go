@@ -0,0 +1,318 @@
+package fulltext
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func TestUnicodeTokenizer(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{name: "lowercases", text: "The Quick Brown Fox", want: []string{"the", "quick", "brown", "fox"}},
+		{name: "splits on punctuation", text: "sea-shells|by_the:sea", want: []string{"sea", "shells", "by", "the", "sea"}},
+		{name: "keeps digits", text: "model 3 in 2024", want: []string{"model", "3", "in", "2024"}},
+		{name: "keeps non-ASCII letters", text: "Café Ünïcode", want: []string{"café", "ünïcode"}},
+		{name: "empty", text: "  ", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UnicodeTokenizer.Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UnicodeTokenizer.Tokenize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_Search_unicodeTokenizer(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService(WithTokenizer(UnicodeTokenizer))
+	if err := svc.Upsert(ctx, []Doc{docOne, docTwo, docThree, {ID: 4, Text: "Crème brûlée"}}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query string
+		want  []uint64
+	}{
+		{query: "Fox", want: []uint64{docOne.ID}},
+		{query: "row", want: []uint64{}},
+		{query: "pET PiP", want: []uint64{docThree.ID}},
+		{query: "jump", want: []uint64{docOne.ID, docThree.ID}},
+		{query: "brûl", want: []uint64{4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := svc.Search(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnicodeTokenizer_TokenizeSpans(t *testing.T) {
+	text := "  Peter Piper's PICKLED—peppers, ünïcode!"
+	words, spans := UnicodeTokenizer.(SpanTokenizer).TokenizeSpans(text)
+	if want := UnicodeTokenizer.Tokenize(text); !reflect.DeepEqual(words, want) {
+		t.Errorf("TokenizeSpans() words = %q, want %q", words, want)
+	}
+	want := []string{"Peter", "Piper", "s", "PICKLED", "peppers", "ünïcode"}
+	for i, span := range spans {
+		if got := text[span.Offset : span.Offset+span.Length]; got != want[i] {
+			t.Errorf("spans[%d] covers %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestNumberTokenizer(t *testing.T) {
+	text := "Part 12345 costs $3.99, or 1,234.50 per case of v2 abc123 widgets."
+	tests := []struct {
+		name string
+		base Tokenizer
+		want []string
+	}{
+		{
+			name: "default",
+			base: DefaultTokenizer,
+			want: []string{"part", "12345", "costs", "3.99", "or", "1234.50", "per", "case", "of", "v2", "abc123", "widgets"},
+		},
+		{
+			name: "unicode",
+			base: UnicodeTokenizer,
+			want: []string{"part", "12345", "costs", "3.99", "or", "1234.50", "per", "case", "of", "v2", "abc123", "widgets"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok := NumberTokenizer(tt.base)
+			if got := tok.Tokenize(text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tokenize() = %q, want %q", got, tt.want)
+			}
+			words, spans := tok.(SpanTokenizer).TokenizeSpans(text)
+			if !reflect.DeepEqual(words, tt.want) {
+				t.Errorf("TokenizeSpans() words = %q, want %q", words, tt.want)
+			}
+			if got := text[spans[5].Offset : spans[5].Offset+spans[5].Length]; got != "1,234.50" {
+				t.Errorf("TokenizeSpans() span of %q covers %q", words[5], got)
+			}
+		})
+	}
+}
+
+func TestService_Search_numbers(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService(WithTokenizer(NumberTokenizer(DefaultTokenizer)))
+	docs := []Doc{
+		{ID: 1, Text: "Part 12345 costs $3.99"},
+		{ID: 2, Text: "Part 1,234.50 per case"},
+		{ID: 3, Text: "Part 3999 is discontinued"},
+	}
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query string
+		want  []uint64
+	}{
+		{query: "123", want: []uint64{1, 2}},
+		{query: "1234", want: []uint64{1, 2}},
+		{query: "1,234.5", want: []uint64{2}},
+		{query: "3.99", want: []uint64{1}},
+		{query: "399", want: []uint64{3}},
+		{query: "part 3.9", want: []uint64{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := svc.Search(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddressTokenizer(t *testing.T) {
+	text := "Mail First.Last@Mail.Example.com or see https://www.example.com/docs/a?q=1. Also example.org, not bob@localhost."
+	want := []string{
+		"mail",
+		"first.last@mail.example.com", "mail.example.com", "example.com", "first", "last", "mail", "example", "com",
+		"or", "see",
+		"https://www.example.com/docs/a?q=1", "www.example.com", "example.com", "https", "docs", "a", "q", "1", "www", "example", "com",
+		"also",
+		"example.org", "example", "org",
+		"not", "bob", "localhost",
+	}
+	tok := AddressTokenizer(UnicodeTokenizer)
+	if got := tok.Tokenize(text); !reflect.DeepEqual(got, want) {
+		t.Errorf("Tokenize() = %q, want %q", got, want)
+	}
+	words, spans := tok.(SpanTokenizer).TokenizeSpans(text)
+	if !reflect.DeepEqual(words, want) {
+		t.Errorf("TokenizeSpans() words = %q, want %q", words, want)
+	}
+	for i, wantSpan := range map[int]string{2: "First.Last@Mail.Example.com", 21: "https://www.example.com/docs/a?q=1", 25: "example.org"} {
+		if got := text[spans[i].Offset : spans[i].Offset+spans[i].Length]; got != wantSpan {
+			t.Errorf("TokenizeSpans() span of %q covers %q, want %q", words[i], got, wantSpan)
+		}
+	}
+}
+
+func TestService_Search_addresses(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService(WithTokenizer(AddressTokenizer(DefaultTokenizer)))
+	docs := []Doc{
+		{ID: 1, Text: "Contact user@example.com for access"},
+		{ID: 2, Text: "Escalate to admin@mail.example.com"},
+		{ID: 3, Text: "Docs are at https://example.com/docs/setup"},
+		{ID: 4, Text: "Contact user@example.org instead"},
+		{ID: 5, Text: "An example of comments"},
+	}
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query string
+		want  []uint64
+	}{
+		{query: "user@example.com", want: []uint64{1}},
+		{query: "USER@Example.COM", want: []uint64{1}},
+		{query: "example.com", want: []uint64{1, 2, 3}},
+		{query: "mail.example.com", want: []uint64{2}},
+		{query: "https://example.com/docs", want: []uint64{3}},
+		{query: "example.org", want: []uint64{4}},
+		{query: "user", want: []uint64{1, 4}},
+		{query: "setup", want: []uint64{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := svc.Search(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_Search_normalizer(t *testing.T) {
+	ctx := context.TODO()
+	turkish := func(text string) string { return strings.ToLowerSpecial(unicode.TurkishCase, text) }
+	german := func(text string) string { return strings.ReplaceAll(strings.ToLower(text), "ß", "ss") }
+	tests := []struct {
+		name      string
+		normalize func(string) string
+		text      string
+		query     string
+		want      []uint64
+	}{
+		{name: "Turkish dotted capital I", normalize: turkish, text: "İSTANBUL", query: "istanbul", want: []uint64{1}},
+		{name: "Turkish dotless capital I", normalize: turkish, text: "DIYARBAKIR", query: "dıyarbakır", want: []uint64{1}},
+		{name: "Turkish dotless i does not match dotted", normalize: turkish, text: "DIYARBAKIR", query: "diyarbakir", want: []uint64{}},
+		{name: "German sharp s matches ss", normalize: german, text: "Straße", query: "strasse", want: []uint64{1}},
+		{name: "German ss matches sharp s", normalize: german, text: "STRASSE", query: "straße", want: []uint64{1}},
+		{name: "German prefix across sharp s", normalize: german, text: "Großbritannien", query: "gross", want: []uint64{1}},
+		{name: "without a normalizer I folds to dotted i", text: "DIYARBAKIR", query: "dıyarbakır", want: []uint64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []Option{WithTokenizer(UnicodeTokenizer)}
+			if tt.normalize != nil {
+				opts = append(opts, WithNormalizer(tt.normalize))
+			}
+			svc := NewService(opts...)
+			if err := svc.Upsert(ctx, []Doc{{ID: 1, Text: tt.text}}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := svc.Search(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFoldRepeats(t *testing.T) {
+	tests := []struct {
+		word string
+		keep int
+		want string
+	}{
+		{word: "sooo", keep: 1, want: "so"},
+		{word: "sooo", keep: 2, want: "soo"},
+		{word: "goood", keep: 1, want: "god"},
+		{word: "goood", keep: 2, want: "good"},
+		{word: "good", keep: 1, want: "good"},
+		{word: "bookkeeper", keep: 1, want: "bookkeeper"},
+		{word: "yessss", keep: 1, want: "yes"},
+		{word: "whyyy", keep: 2, want: "whyy"},
+		{word: "ééé", keep: 1, want: "é"},
+		{word: "1000", keep: 1, want: "1000"},
+		{word: "aaabbbccc", keep: 1, want: "abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			if got := foldRepeats(tt.word, tt.keep); got != tt.want {
+				t.Errorf("foldRepeats(%q, %d) = %q, want %q", tt.word, tt.keep, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_Search_repeatFolding(t *testing.T) {
+	ctx := context.TODO()
+	docs := []Doc{{ID: 1, Text: "so good"}, {ID: 2, Text: "Sooo goood!!!"}, {ID: 3, Text: "1000 days"}, {ID: 4, Text: "10 days"}}
+	tests := []struct {
+		name  string
+		keep  int
+		query string
+		want  []uint64
+	}{
+		{name: "noisy query matches clean text", keep: 1, query: "sooo", want: []uint64{1, 2}},
+		{name: "clean query matches noisy text", keep: 1, query: "so", want: []uint64{1, 2}},
+		{name: "keep two", keep: 2, query: "goooood", want: []uint64{1, 2}},
+		{name: "digits are not folded", keep: 1, query: "1000", want: []uint64{3}},
+		{name: "without folding", query: "sooo", want: []uint64{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewService(WithRepeatFolding(tt.keep))
+			if err := svc.Upsert(ctx, docs); err != nil {
+				t.Fatal(err)
+			}
+			got, err := svc.Search(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+	svc := NewService(WithRepeatFolding(1))
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	got, err := svc.SearchTerms(ctx, []string{"soooo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.SearchTerms() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,97 @@
+package fulltext
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dgryski/go-trigram"
+)
+
+// WeightedTerm is a query term and the weight of its matches in a document's score
+type WeightedTerm struct {
+	Term   string  // analyzed like a query passed to Search
+	Weight float64 // multiplies the term's hit count
+}
+
+// exactBoost is how many hits SearchWeighted counts for each whole word match
+const exactBoost = 2
+
+// Result is a matching document and its score
+type Result struct {
+	ID    uint64 // external ID of the document
+	Score float64
+}
+
+// SearchWeighted returns the documents that match every term, as Search would for the
+// terms joined into one query, ranked by score from highest to lowest.  The base
+// relevance of a term in a document is its hit count, the number of times its words
+// (and their synonyms) match as counted by SearchCounts, and a document's score is the
+// sum over the terms of each term's hit count multiplied by its weight.  Weights are
+// therefore relative: doubling every weight doubles every score but leaves the ranking
+// unchanged, while doubling the weight of a single term lets one of its matches count
+// as much as two matches of an equally weighted term.  A hit where a query word matches
+// a whole indexed word rather than only its beginning counts exactBoost times over, so
+// that a document containing "sea" outranks one containing only "seashore" or
+// "season".  Ties keep insertion order.
+func (svc *Service) SearchWeighted(ctx context.Context, terms []WeightedTerm) ([]Result, error) {
+	if err := svc.acquireSearch(); err != nil {
+		return nil, err
+	}
+	defer svc.releaseSearch()
+	if len(terms) == 0 {
+		return nil, fmt.Errorf(`at least one term is required`)
+	}
+	queries := make([]*searchQuery, 0, len(terms))
+	defer func() {
+		for _, q := range queries {
+			q.release()
+		}
+	}()
+	for i, term := range terms {
+		q, err := svc.newQuery(term.Term, SearchOptions{})
+		if err != nil {
+			return nil, fmt.Errorf(`terms[%d]: %w`, i, err)
+		}
+		queries = append(queries, q)
+	}
+	svc.RLock()
+	defer svc.RUnlock()
+	var candidates []trigram.DocID
+	for i, q := range queries {
+		if i == 0 {
+			candidates = svc.queryCandidates(q)
+		} else {
+			candidates = intersectDocIDs(candidates, svc.queryCandidates(q))
+		}
+	}
+	results := make([]Result, 0, len(candidates))
+	err := svc.verify(ctx, candidates, matchesAll(queries), func(_ trigram.DocID, doc meta) bool {
+		var score float64
+		for i, q := range queries {
+			score += terms[i].Weight * float64(q.hits(doc)+(exactBoost-1)*svc.exactHits(q, doc))
+		}
+		results = append(results, Result{ID: doc.id, Score: score})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	return results, nil
+}
+
+// exactHits returns the number of times q's words, and their synonyms, match whole
+// words in the document
+func (svc *Service) exactHits(q *searchQuery, doc meta) (n int) {
+	for _, word := range q.alternatives() {
+		whole := strings.TrimSuffix(word, saDelim) + saDelim
+		if svc.unanchored && !strings.HasPrefix(whole, saDelim) {
+			// without the anchor, only the preceding delimiter marks the start of a word
+			whole = saDelim + whole
+		}
+		n += len(doc.sa.Lookup([]byte(whole), -1))
+	}
+	return
+}
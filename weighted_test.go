@@ -0,0 +1,78 @@
+package fulltext
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestService_SearchWeighted(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	docs := []Doc{
+		{ID: 1, Text: "apple apple banana"},
+		{ID: 2, Text: "apple banana banana"},
+		{ID: 3, Text: "apple cherry"},
+	}
+	if err := svc.Upsert(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		terms []WeightedTerm
+		want  []Result
+	}{
+		{
+			name:  "equal weights tie and keep insertion order",
+			terms: []WeightedTerm{{Term: "apple", Weight: 1}, {Term: "banana", Weight: 1}},
+			want:  []Result{{ID: 1, Score: 6}, {ID: 2, Score: 6}},
+		},
+		{
+			name:  "weighting banana flips the order",
+			terms: []WeightedTerm{{Term: "apple", Weight: 1}, {Term: "banana", Weight: 2}},
+			want:  []Result{{ID: 2, Score: 10}, {ID: 1, Score: 8}},
+		},
+		{
+			name:  "weighting apple restores it",
+			terms: []WeightedTerm{{Term: "apple", Weight: 3}, {Term: "banana", Weight: 1}},
+			want:  []Result{{ID: 1, Score: 14}, {ID: 2, Score: 10}},
+		},
+		{
+			name:  "a single term ranks by hit count",
+			terms: []WeightedTerm{{Term: "app", Weight: 0.5}},
+			want:  []Result{{ID: 1, Score: 1}, {ID: 2, Score: 0.5}, {ID: 3, Score: 0.5}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.SearchWeighted(ctx, tt.terms)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.SearchWeighted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := svc.SearchWeighted(ctx, []WeightedTerm{{Term: "a", Weight: 1}}); err == nil {
+		t.Error("Service.SearchWeighted() should reject a term without enough content")
+	}
+}
+
+func TestService_SearchWeighted_exact(t *testing.T) {
+	ctx := context.TODO()
+	svc := NewService()
+	seashore := Doc{ID: 4, Text: "seashore seasons seaside"}
+	if err := svc.Upsert(ctx, []Doc{docOne, seashore, docTwo, docThree}); err != nil {
+		t.Fatal(err)
+	}
+	// docTwo has fewer matches for "sea" than seashore, but they are whole words
+	got, err := svc.SearchWeighted(ctx, []WeightedTerm{{Term: "sea", Weight: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Result{{ID: docTwo.ID, Score: 4}, {ID: seashore.ID, Score: 3}, {ID: docThree.ID, Score: 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.SearchWeighted() = %v, want %v", got, want)
+	}
+}